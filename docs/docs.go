@@ -15,6 +15,22 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/healthz": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    }
+                }
+            }
+        },
         "/order/{order_uid}": {
             "get": {
                 "summary": "Get order by UID",
@@ -32,6 +48,321 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/models.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Order version"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {}
+                    },
+                    "503": {
+                        "description": "Request canceled",
+                        "schema": {}
+                    },
+                    "504": {
+                        "description": "Request timed out",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "description": "Keyset pagination ordered by date_created desc, order_uid desc",
+                "summary": "List orders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Customer ID",
+                        "name": "customer_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Track number",
+                        "name": "track_number",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Delivery service",
+                        "name": "delivery_service",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entry",
+                        "name": "entry",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Locale",
+                        "name": "locale",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC3339)",
+                        "name": "date_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC3339)",
+                        "name": "date_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Next cursor from previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (max 100)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.OrderList"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {}
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create or update order",
+                "parameters": [
+                    {
+                        "description": "Order",
+                        "name": "order",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Idempotency key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected order version (ETag)",
+                        "name": "If-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New order version"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {}
+                    },
+                    "409": {
+                        "description": "Idempotency key conflict or item/payment belongs to another order",
+                        "schema": {}
+                    },
+                    "412": {
+                        "description": "Order version does not match If-Match",
+                        "schema": {}
+                    },
+                    "422": {
+                        "description": "Validation error",
+                        "schema": {
+                            "$ref": "#/definitions/errorx.ValidationError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/orders/{order_uid}/diff": {
+            "get": {
+                "description": "Field-level diff; items are matched by rid and payments by transaction",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Diff two order versions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Base version (default: the one before to, 0 - empty order)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Target version (default: latest)",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.OrderDiff"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad request",
+                        "schema": {}
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/orders/{order_uid}/history": {
+            "get": {
+                "description": "Versions in ascending order, each with a full order snapshot",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get order change history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.OrderVersion"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not found",
+                        "schema": {}
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/orders/{order_uid}/status": {
+            "patch": {
+                "description": "Allowed transitions: created -\u003e paid|cancelled, paid -\u003e assembling|cancelled,\nassembling -\u003e shipped|cancelled, shipped -\u003e delivered|returned, delivered -\u003e returned",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Change order status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Order UID",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New status",
+                        "name": "update",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.StatusUpdate"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected order version (ETag)",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Idempotency key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New order version"
+                            }
                         }
                     },
                     "400": {
@@ -41,12 +372,106 @@ const docTemplate = `{
                     "404": {
                         "description": "Not found",
                         "schema": {}
+                    },
+                    "409": {
+                        "description": "Transition not allowed",
+                        "schema": {}
+                    },
+                    "412": {
+                        "description": "Order version does not match If-Match",
+                        "schema": {}
+                    },
+                    "422": {
+                        "description": "Unknown status",
+                        "schema": {
+                            "$ref": "#/definitions/errorx.ValidationError"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal error",
+                        "schema": {}
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Checks database, kafka brokers, consumer group membership and cache warm-up",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
+        "errorx.FieldError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "errorx.ValidationError": {
+            "type": "object",
+            "properties": {
+                "fields": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/errorx.FieldError"
+                    }
+                }
+            }
+        },
+        "health.Component": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "latency_ms": {
+                    "type": "number"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "health.Report": {
+            "type": "object",
+            "properties": {
+                "components": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/health.Component"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "models.Delivery": {
             "type": "object",
             "required": [
@@ -82,6 +507,19 @@ const docTemplate = `{
                 }
             }
         },
+        "models.FieldChange": {
+            "type": "object",
+            "properties": {
+                "new": {},
+                "old": {},
+                "op": {
+                    "type": "string"
+                },
+                "path": {
+                    "type": "string"
+                }
+            }
+        },
         "models.Item": {
             "type": "object",
             "required": [
@@ -181,6 +619,9 @@ const docTemplate = `{
                 "locale": {
                     "type": "string"
                 },
+                "net_paid": {
+                    "type": "integer"
+                },
                 "oof_shard": {
                     "type": "string"
                 },
@@ -190,14 +631,124 @@ const docTemplate = `{
                 "payment": {
                     "$ref": "#/definitions/models.Payment"
                 },
+                "payments": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Payment"
+                    }
+                },
                 "shardkey": {
                     "type": "string"
                 },
                 "sm_id": {
                     "type": "integer"
                 },
+                "status": {
+                    "$ref": "#/definitions/models.OrderStatus"
+                },
                 "track_number": {
                     "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                },
+                "warnings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.OrderWarning"
+                    }
+                }
+            }
+        },
+        "models.OrderDiff": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.FieldChange"
+                    }
+                },
+                "from": {
+                    "type": "integer"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.OrderList": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "orders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Order"
+                    }
+                }
+            }
+        },
+        "models.OrderStatus": {
+            "type": "string",
+            "enum": [
+                "created",
+                "paid",
+                "assembling",
+                "shipped",
+                "delivered",
+                "cancelled",
+                "returned"
+            ],
+            "x-enum-varnames": [
+                "StatusCreated",
+                "StatusPaid",
+                "StatusAssembling",
+                "StatusShipped",
+                "StatusDelivered",
+                "StatusCancelled",
+                "StatusReturned"
+            ]
+        },
+        "models.OrderVersion": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "snapshot": {
+                    "type": "object"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "source_ref": {
+                    "type": "string"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.OrderWarning": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string"
+                },
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
                 }
             }
         },
@@ -245,6 +796,26 @@ const docTemplate = `{
                 },
                 "transaction": {
                     "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.StatusUpdate": {
+            "type": "object",
+            "properties": {
+                "order_uid": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "source": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/models.OrderStatus"
                 }
             }
         }
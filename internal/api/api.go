@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -9,16 +10,30 @@ import (
 	"order-manager/internal/config"
 	"order-manager/internal/controller/http"
 	"order-manager/internal/controller/kafka"
+	"order-manager/internal/controller/notify"
+	"order-manager/internal/health"
+	"order-manager/internal/metrics"
+	"order-manager/internal/models"
+	"order-manager/internal/outbox"
 	"order-manager/internal/repository"
 	"order-manager/internal/service"
+	"order-manager/internal/tracing"
 	"order-manager/pkg/db"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// listenerReadyTimeout ограничивает ожидание первого LISTEN перед прогревом кэша:
+// если БД недоступна, прогрев все равно завершится ошибкой
+const listenerReadyTimeout = 10 * time.Second
+
 type App struct {
 	cfg         config.Config
 	logger      *slog.Logger
@@ -28,8 +43,15 @@ type App struct {
 	pool        *pgxpool.Pool
 	cache       *cache.Cache
 	kafkaReader *kafka.Consumer
+	listener    *notify.Listener
+	relay       *outbox.Relay
+	cacheWarm   atomic.Bool
+
+	shutdownTracing func(context.Context) error
 }
 
+var errCacheWarming = errors.New("cache warm-up in progress")
+
 func NewApp() *App {
 	app := &App{}
 
@@ -40,54 +62,166 @@ func NewApp() *App {
 
 	app.logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
+	if cfg.InstanceID == "" {
+		cfg.InstanceID = uuid.NewString()
+	}
+
+	app.shutdownTracing, err = tracing.Init(context.Background(), cfg.Tracing, cfg.InstanceID)
+	if err != nil {
+		log.Fatalf("Failed to init tracing %v", err)
+	}
+
 	app.pool, err = db.InitPool(fmt.Sprintf("postgresql://%s:%s@%s:%s/%s",
 		cfg.Db.User, cfg.Db.Password, cfg.Db.Host, cfg.Db.Port, cfg.Db.Name))
 	if err != nil {
 		log.Fatalf("Failed to connect to db %v", err)
 	}
 
-	app.cache = cache.NewCache(cfg.Cache.Size)
+	app.cache = cache.NewCache(cfg.Cache)
 
-	app.repo = repository.NewRepository(app.pool)
+	app.repo = repository.NewRepository(app.pool, cfg.Db, cfg.InstanceID)
 
 	app.s = service.NewService(app.repo, app.cache, app.logger)
 
-	app.kafkaReader = kafka.NewConsumer(app.s, app.logger, cfg.Topic, cfg.Brokers)
+	app.kafkaReader = kafka.NewConsumer(app.s, app.logger, cfg.Kafka, cfg.InstanceID)
+
+	app.relay = outbox.NewRelay(app.repo, app.logger, cfg.Outbox, cfg.Kafka.Brokers)
+
+	app.listener = notify.NewListener(app.pool, app.s, app.logger, cfg.InstanceID, cfg.RefreshOnNotify)
+
+	metrics.Registry.MustRegister(metrics.NewCacheCollector(app.cache), metrics.NewPoolCollector(app.pool))
+
+	checker := health.NewChecker(cfg.HealthCheckTimeout)
+	checker.Register("postgres", app.pool.Ping)
+	checker.Register("kafka", app.kafkaReader.PingBrokers)
+	checker.Register("kafka_group", app.kafkaReader.CheckGroupMembership)
+	checker.Register("cache", func(context.Context) error {
+		if !app.cacheWarm.Load() {
+			return errCacheWarming
+		}
+		return nil
+	})
 
 	handlerOrder := http.NewHandler(app.s, app.logger)
-	app.httpServer = http.NewServer(handlerOrder, cfg.Addr)
+	app.httpServer = http.NewServer(handlerOrder, http.NewHealthHandler(checker), cfg.HttpServer)
 	app.cfg = cfg
 
 	return app
 }
 
 func (a *App) RunApp() {
-	err := a.s.FillCache(a.cfg.Cache.Size)
-	if err != nil {
-		log.Fatalf("Failed to fill cache %v", err)
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	go a.kafkaReader.Start(ctx)
-
+	// HTTP-сервер стартует до прогрева, чтобы liveness-проверка отвечала сразу
 	go func() {
-		err = a.httpServer.StartHttpServer()
+		err := a.httpServer.StartHttpServer()
 		if err != nil {
 			log.Fatalf("Failed to start http server %v", err)
 		}
 	}()
 
+	var background sync.WaitGroup
+	run := func(f func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			f(ctx)
+		}()
+	}
+
+	// уведомления должны слушаться до прогрева: изменения, сделанные во время загрузки
+	// кэша, иначе не дошли бы до него
+	run(a.listener.Start)
+	select {
+	case <-a.listener.Ready():
+	case <-time.After(listenerReadyTimeout):
+		a.logger.Warn("Notification listener is not ready, warming cache anyway")
+	}
+
+	a.warmCache(ctx)
+	a.cacheWarm.Store(true)
+
+	run(a.cache.StartJanitor)
+	run(func(ctx context.Context) { a.cache.StartSnapshotter(ctx, a.logger) })
+	if models.WarmStrategy(a.cfg.WarmStrategy) == models.WarmRecentlyRead {
+		run(func(ctx context.Context) { a.s.StartReadTracker(ctx, a.cfg.ReadTrackInterval) })
+	}
+	run(a.relay.Start)
+	go a.kafkaReader.Start(ctx)
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
 	<-stop
 
-	if err := a.kafkaReader.Stop(); err != nil {
-		log.Fatalf("Failed to stop kafka %v", err)
+	a.shutdown(cancel, &background)
+}
+
+// shutdown останавливает приложение по фазам так, чтобы пул закрывался последним,
+// когда ни HTTP-запросы, ни обработка сообщений его уже не используют
+func (a *App) shutdown(stopBackground context.CancelFunc, background *sync.WaitGroup) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.ShutdownTimeout)
+	defer cancel()
+
+	a.logger.Info("Shutting down", slog.Duration("timeout", a.cfg.ShutdownTimeout))
+
+	a.logger.Info("Shutdown: stopping http server")
+	if err := a.httpServer.Shutdown(ctx); err != nil {
+		a.logger.Error("Failed to stop http server", slog.String("error", err.Error()))
+	}
+
+	a.logger.Info("Shutdown: draining kafka consumer")
+	if err := a.kafkaReader.Shutdown(ctx); err != nil {
+		a.logger.Error("Failed to stop kafka consumer", slog.String("error", err.Error()))
+	}
+
+	a.logger.Info("Shutdown: stopping background workers")
+	stopBackground()
+	stopped := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		a.logger.Warn("Background workers did not stop in time")
+	}
+
+	a.logger.Info("Shutdown: saving cache snapshot")
+	if err := a.cache.SaveSnapshot(); err != nil && !errors.Is(err, cache.ErrSnapshotDisabled) {
+		a.logger.Error("Failed to save cache snapshot", slog.String("error", err.Error()))
+	}
+
+	a.logger.Info("Shutdown: flushing traces")
+	if err := a.shutdownTracing(ctx); err != nil {
+		a.logger.Error("Failed to flush traces", slog.String("error", err.Error()))
 	}
+
+	a.logger.Info("Shutdown: closing db pool")
 	a.pool.Close()
 
 	a.logger.Info("application stopped")
 }
+
+// warmCache восстанавливает кэш из снапшота, а если его нет или он поврежден - из БД.
+// Загруженные заказы сверяются с БД: снапшот мог устареть, пока реплика не работала,
+// а заказ, измененный во время загрузки, мог попасть в кэш уже после уведомления о нем.
+func (a *App) warmCache(ctx context.Context) {
+	loaded, err := a.cache.LoadSnapshot()
+	if err == nil {
+		a.logger.Info("Cache restored from snapshot", slog.Int("orders", loaded))
+	} else {
+		if !errors.Is(err, cache.ErrSnapshotDisabled) {
+			a.logger.Warn("Failed to load cache snapshot, filling from db", slog.String("error", err.Error()))
+		}
+		if err = a.s.FillCache(ctx, a.cfg.Cache.Size, models.WarmStrategy(a.cfg.WarmStrategy)); err != nil {
+			log.Fatalf("Failed to fill cache %v", err)
+		}
+	}
+
+	if _, err = a.s.ReconcileCache(ctx); err != nil {
+		log.Fatalf("Failed to check cache against db %v", err)
+	}
+}
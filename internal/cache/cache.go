@@ -1,49 +1,295 @@
 package cache
 
 import (
+	"context"
+	"order-manager/internal/config"
 	"order-manager/internal/models"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("order-manager/internal/cache")
+
+const (
+	EvictionCapacity = "capacity"
+	EvictionBytes    = "bytes"
+	EvictionExpired  = "expired"
+	EvictionInvalid  = "invalidated"
 )
 
+type entry struct {
+	order     models.Order
+	size      int64
+	expiresAt time.Time
+}
+
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Entries   int
+	NotFound  int
+	Bytes     int64
+	Evictions map[string]uint64
+}
+
 type Cache struct {
-	orders    []string
-	cacheList map[string]models.Order
-	size      int
-	mu        *sync.RWMutex
+	cacheList map[string]*entry
+	policy    policy
+	mu        *sync.Mutex
+
+	// заказы, которых нет в БД, с моментом истечения отметки
+	notFound      map[string]time.Time
+	notFoundLimit int
+	negativeTTL   time.Duration
+
+	ttl             time.Duration
+	maxBytes        int64
+	janitorInterval time.Duration
+
+	snapshotPath     string
+	snapshotInterval time.Duration
+
+	bytes     int64
+	hits      uint64
+	misses    uint64
+	evictions map[string]uint64
 }
 
-func NewCache(size int) *Cache {
+func NewCache(cfg config.Cache) *Cache {
 	return &Cache{
-		orders:    make([]string, 0, size),
-		cacheList: make(map[string]models.Order),
-		size:      size,
-		mu:        &sync.RWMutex{},
+		cacheList:        make(map[string]*entry),
+		policy:           newPolicy(cfg.Policy, max(cfg.Size, 1)),
+		mu:               &sync.Mutex{},
+		notFound:         make(map[string]time.Time),
+		notFoundLimit:    max(cfg.Size, 1),
+		negativeTTL:      cfg.NegativeTTL,
+		ttl:              cfg.TTL,
+		maxBytes:         cfg.MaxBytes,
+		janitorInterval:  cfg.JanitorInterval,
+		snapshotPath:     cfg.SnapshotPath,
+		snapshotInterval: cfg.SnapshotInterval,
+		evictions:        make(map[string]uint64),
+	}
+}
+
+func (c *Cache) SetOrder(ctx context.Context, order models.Order) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = time.Now().Add(c.ttl)
+	}
+	c.setLocked(order, expiresAt)
+}
+
+func (c *Cache) setLocked(order models.Order, expiresAt time.Time) {
+	delete(c.notFound, order.OrderUID)
+
+	// загрузка из БД, начатая до сохранения заказа, может закончиться позже него:
+	// более новая версия в кэше не перезаписывается старой
+	if old, found := c.cacheList[order.OrderUID]; found && old.order.Version > order.Version {
+		return
+	}
+
+	e := &entry{order: order, size: approxSize(&order), expiresAt: expiresAt}
+
+	if c.maxBytes > 0 && e.size > c.maxBytes {
+		// заказ больше всего бюджета - не кэшируем, а старую версию убираем
+		if _, found := c.cacheList[order.OrderUID]; found {
+			c.removeLocked(order.OrderUID, EvictionBytes)
+		} else {
+			c.evictions[EvictionBytes]++
+		}
+		return
+	}
+
+	if old, found := c.cacheList[order.OrderUID]; found {
+		c.bytes += e.size - old.size
+		c.cacheList[order.OrderUID] = e
+		c.policy.access(order.OrderUID)
+	} else {
+		c.bytes += e.size
+		c.cacheList[order.OrderUID] = e
+		if victim, evicted := c.policy.add(order.OrderUID); evicted {
+			c.deleteLocked(victim, EvictionCapacity)
+		}
+	}
+
+	for c.maxBytes > 0 && c.bytes > c.maxBytes {
+		victim, evicted := c.policy.evict()
+		if !evicted {
+			break
+		}
+		c.deleteLocked(victim, EvictionBytes)
+	}
+}
+
+func (c *Cache) GetOrder(ctx context.Context, orderUID string) (models.Order, bool) {
+	_, span := tracer.Start(ctx, "Cache.GetOrder", trace.WithAttributes(attribute.String("order.uid", orderUID)))
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, found := c.cacheList[orderUID]
+	if found && e.expired(time.Now()) {
+		c.removeLocked(orderUID, EvictionExpired)
+		found = false
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	if !found {
+		c.misses++
+		return models.Order{}, false
+	}
+
+	c.hits++
+	c.policy.access(orderUID)
+	return e.order, true
+}
+
+// Delete убирает заказ и отметку об его отсутствии. Возвращает true, если заказ был в кэше.
+func (c *Cache) Delete(ctx context.Context, orderUID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.notFound, orderUID)
+	if _, found := c.cacheList[orderUID]; !found {
+		return false
+	}
+	c.removeLocked(orderUID, EvictionInvalid)
+	return true
+}
+
+// SetNotFound запоминает, что заказа нет в БД, на время negativeTTL
+func (c *Cache) SetNotFound(ctx context.Context, orderUID string) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.notFound) >= c.notFoundLimit {
+		c.removeExpiredNotFound(time.Now())
+	}
+	if len(c.notFound) >= c.notFoundLimit {
+		for uid := range c.notFound {
+			delete(c.notFound, uid)
+			break
+		}
+	}
+	c.notFound[orderUID] = time.Now().Add(c.negativeTTL)
+}
+
+func (c *Cache) IsNotFound(ctx context.Context, orderUID string) bool {
+	_, span := tracer.Start(ctx, "Cache.IsNotFound", trace.WithAttributes(attribute.String("order.uid", orderUID)))
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt, found := c.notFound[orderUID]
+	if found && time.Now().After(expiresAt) {
+		delete(c.notFound, orderUID)
+		found = false
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", found))
+	return found
+}
+
+// Versions возвращает версии закэшированных заказов по order_uid
+func (c *Cache) Versions() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	versions := make(map[string]int, len(c.cacheList))
+	for orderUID, e := range c.cacheList {
+		versions[orderUID] = e.order.Version
 	}
+	return versions
 }
 
-func (c *Cache) SetOrder(order models.Order) {
+func (c *Cache) Stats() Stats {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if _, found := c.cacheList[order.OrderUID]; found {
-		c.cacheList[order.OrderUID] = order
+	evictions := make(map[string]uint64, len(c.evictions))
+	for reason, n := range c.evictions {
+		evictions[reason] = n
+	}
+
+	return Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Entries:   len(c.cacheList),
+		NotFound:  len(c.notFound),
+		Bytes:     c.bytes,
+		Evictions: evictions,
+	}
+}
+
+// StartJanitor периодически удаляет просроченные записи, пока не отменен ctx
+func (c *Cache) StartJanitor(ctx context.Context) {
+	if (c.ttl <= 0 && c.negativeTTL <= 0) || c.janitorInterval <= 0 {
 		return
 	}
 
-	if len(c.orders) >= c.size {
-		old := c.orders[0]
-		delete(c.cacheList, old)
-		c.orders = c.orders[1:]
+	ticker := time.NewTicker(c.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.removeExpired()
+		}
+	}
+}
+
+func (c *Cache) removeExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for uid, e := range c.cacheList {
+		if e.expired(now) {
+			c.removeLocked(uid, EvictionExpired)
+		}
 	}
+	c.removeExpiredNotFound(now)
+}
 
-	c.cacheList[order.OrderUID] = order
-	c.orders = append(c.orders, order.OrderUID)
+func (c *Cache) removeExpiredNotFound(now time.Time) {
+	for uid, expiresAt := range c.notFound {
+		if now.After(expiresAt) {
+			delete(c.notFound, uid)
+		}
+	}
 }
 
-func (c *Cache) GetOrder(orderUID string) (models.Order, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// removeLocked удаляет запись и из политики, и из словаря
+func (c *Cache) removeLocked(orderUID, reason string) {
+	c.policy.remove(orderUID)
+	c.deleteLocked(orderUID, reason)
+}
+
+// deleteLocked удаляет запись, которую политика уже вытеснила сама
+func (c *Cache) deleteLocked(orderUID, reason string) {
+	e, found := c.cacheList[orderUID]
+	if !found {
+		return
+	}
+	delete(c.cacheList, orderUID)
+	c.bytes -= e.size
+	c.evictions[reason]++
+}
 
-	order, found := c.cacheList[orderUID]
-	return order, found
+func (e *entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
 }
@@ -0,0 +1,193 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"order-manager/internal/cache"
+	"order-manager/internal/config"
+	"order-manager/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_LRUKeepsRecentlyRead(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	c := cache.NewCache(config.Cache{Size: 2, Policy: cache.PolicyLRU})
+
+	c.SetOrder(ctx, models.Order{OrderUID: "a"})
+	c.SetOrder(ctx, models.Order{OrderUID: "b"})
+
+	_, found := c.GetOrder(ctx, "a")
+	assert.True(t, found)
+
+	c.SetOrder(ctx, models.Order{OrderUID: "c"})
+
+	_, found = c.GetOrder(ctx, "a")
+	assert.True(t, found)
+	_, found = c.GetOrder(ctx, "b")
+	assert.False(t, found)
+	_, found = c.GetOrder(ctx, "c")
+	assert.True(t, found)
+}
+
+func TestCache_TinyLFUResistsScan(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	c := cache.NewCache(config.Cache{Size: 100, Policy: cache.PolicyTinyLFU})
+
+	for i := 0; i < 10; i++ {
+		uid := fmt.Sprintf("hot-%d", i)
+		c.SetOrder(ctx, models.Order{OrderUID: uid})
+		for j := 0; j < 5; j++ {
+			c.GetOrder(ctx, uid)
+		}
+	}
+
+	// однократно прочитанные заказы не должны вытеснить часто читаемые
+	for i := 0; i < 1000; i++ {
+		c.SetOrder(ctx, models.Order{OrderUID: fmt.Sprintf("scan-%d", i)})
+	}
+
+	for i := 0; i < 10; i++ {
+		_, found := c.GetOrder(ctx, fmt.Sprintf("hot-%d", i))
+		assert.True(t, found)
+	}
+}
+
+func TestCache_TTLExpires(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	c := cache.NewCache(config.Cache{Size: 10, TTL: 20 * time.Millisecond})
+
+	c.SetOrder(ctx, models.Order{OrderUID: "a"})
+	_, found := c.GetOrder(ctx, "a")
+	assert.True(t, found)
+
+	time.Sleep(30 * time.Millisecond)
+
+	_, found = c.GetOrder(ctx, "a")
+	assert.False(t, found)
+
+	stats := c.Stats()
+	assert.Equal(t, 0, stats.Entries)
+	assert.Zero(t, stats.Bytes)
+	assert.EqualValues(t, 1, stats.Evictions[cache.EvictionExpired])
+	assert.EqualValues(t, 1, stats.Hits)
+	assert.EqualValues(t, 1, stats.Misses)
+}
+
+func TestCache_MaxBytes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	probe := cache.NewCache(config.Cache{Size: 10})
+	probe.SetOrder(ctx, models.Order{OrderUID: "a"})
+	orderSize := probe.Stats().Bytes
+
+	c := cache.NewCache(config.Cache{Size: 10, MaxBytes: 2 * orderSize})
+	c.SetOrder(ctx, models.Order{OrderUID: "a"})
+	c.SetOrder(ctx, models.Order{OrderUID: "b"})
+	c.SetOrder(ctx, models.Order{OrderUID: "c"})
+
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.LessOrEqual(t, stats.Bytes, 2*orderSize)
+	assert.EqualValues(t, 1, stats.Evictions[cache.EvictionBytes])
+
+	_, found := c.GetOrder(ctx, "a")
+	assert.False(t, found)
+}
+
+func TestCache_SnapshotRoundTrip(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	cfg := config.Cache{Size: 2, SnapshotPath: filepath.Join(t.TempDir(), "cache.snapshot")}
+
+	c := cache.NewCache(cfg)
+	c.SetOrder(ctx, models.Order{OrderUID: "a", TrackNumber: "track-a"})
+	c.SetOrder(ctx, models.Order{OrderUID: "b"})
+	c.GetOrder(ctx, "a")
+	require.NoError(t, c.SaveSnapshot())
+
+	restored := cache.NewCache(cfg)
+	loaded, err := restored.LoadSnapshot()
+	require.NoError(t, err)
+	assert.Equal(t, 2, loaded)
+
+	order, found := restored.GetOrder(ctx, "a")
+	require.True(t, found)
+	assert.Equal(t, "track-a", order.TrackNumber)
+
+	// порядок вытеснения сохраняется: "b" читали раньше, чем "a"
+	restored.SetOrder(ctx, models.Order{OrderUID: "c"})
+	_, found = restored.GetOrder(ctx, "b")
+	assert.False(t, found)
+}
+
+func TestCache_SnapshotCorrupt(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	cfg := config.Cache{Size: 2, SnapshotPath: filepath.Join(t.TempDir(), "cache.snapshot")}
+
+	c := cache.NewCache(cfg)
+	c.SetOrder(ctx, models.Order{OrderUID: "a"})
+	require.NoError(t, c.SaveSnapshot())
+
+	data, err := os.ReadFile(cfg.SnapshotPath)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(cfg.SnapshotPath, data, 0o600))
+
+	_, err = cache.NewCache(cfg).LoadSnapshot()
+	require.ErrorIs(t, err, cache.ErrSnapshotCorrupt)
+}
+
+func TestCache_SnapshotOldVersion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	cfg := config.Cache{Size: 2, SnapshotPath: filepath.Join(t.TempDir(), "cache.snapshot")}
+
+	c := cache.NewCache(cfg)
+	c.SetOrder(ctx, models.Order{OrderUID: "a"})
+	require.NoError(t, c.SaveSnapshot())
+
+	// снапшот старой версии модели отклоняется, и кэш заполняется из БД
+	data, err := os.ReadFile(cfg.SnapshotPath)
+	require.NoError(t, err)
+	data[4] = 1
+	require.NoError(t, os.WriteFile(cfg.SnapshotPath, data, 0o600))
+
+	_, err = cache.NewCache(cfg).LoadSnapshot()
+	require.ErrorIs(t, err, cache.ErrSnapshotCorrupt)
+}
+
+func TestCache_KeepsNewerVersion(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	c := cache.NewCache(config.Cache{Size: 2})
+	c.SetOrder(ctx, models.Order{OrderUID: "a", TrackNumber: "saved", Version: 2})
+
+	// запоздавшая загрузка прочитала заказ до сохранения
+	c.SetOrder(ctx, models.Order{OrderUID: "a", TrackNumber: "loaded", Version: 1})
+
+	order, found := c.GetOrder(ctx, "a")
+	require.True(t, found)
+	assert.Equal(t, "saved", order.TrackNumber)
+
+	c.SetOrder(ctx, models.Order{OrderUID: "a", TrackNumber: "updated", Version: 3})
+	order, _ = c.GetOrder(ctx, "a")
+	assert.Equal(t, "updated", order.TrackNumber)
+}
@@ -0,0 +1,90 @@
+package cache
+
+import "container/list"
+
+const (
+	PolicyLRU     = "lru"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// policy решает, какой ключ вытеснить. Все методы вызываются под мьютексом кэша.
+type policy interface {
+	// add регистрирует новый ключ и возвращает вытесненный, если кэш переполнен.
+	// Вытесненным может оказаться сам key, если политика его не допустила.
+	add(key string) (victim string, evicted bool)
+	access(key string)
+	remove(key string)
+	// evict выбирает и удаляет ключ для вытеснения по внешней причине (например, лимит памяти)
+	evict() (string, bool)
+	// keys возвращает ключи от первого кандидата на вытеснение к самому ценному
+	keys() []string
+}
+
+func newPolicy(name string, capacity int) policy {
+	if name == PolicyTinyLFU {
+		return newTinyLFU(capacity)
+	}
+	return newLRU(capacity)
+}
+
+type lru struct {
+	capacity int
+	ll       *list.List
+	elems    map[string]*list.Element
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		ll:       list.New(),
+		elems:    make(map[string]*list.Element, capacity),
+	}
+}
+
+func (p *lru) add(key string) (string, bool) {
+	if e, found := p.elems[key]; found {
+		p.ll.MoveToFront(e)
+		return "", false
+	}
+
+	p.elems[key] = p.ll.PushFront(key)
+	if p.ll.Len() <= p.capacity {
+		return "", false
+	}
+	return p.removeOldest()
+}
+
+func (p *lru) access(key string) {
+	if e, found := p.elems[key]; found {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lru) remove(key string) {
+	if e, found := p.elems[key]; found {
+		p.ll.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lru) evict() (string, bool) {
+	return p.removeOldest()
+}
+
+func (p *lru) keys() []string {
+	keys := make([]string, 0, p.ll.Len())
+	for e := p.ll.Back(); e != nil; e = e.Prev() {
+		keys = append(keys, e.Value.(string))
+	}
+	return keys
+}
+
+func (p *lru) removeOldest() (string, bool) {
+	e := p.ll.Back()
+	if e == nil {
+		return "", false
+	}
+	key := p.ll.Remove(e).(string)
+	delete(p.elems, key)
+	return key, true
+}
@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"order-manager/internal/models"
+	"unsafe"
+)
+
+const entryOverhead = int64(unsafe.Sizeof(entry{})) + 64
+
+// approxSize оценивает объем памяти заказа: размеры структур плюс длины строк
+func approxSize(order *models.Order) int64 {
+	size := int64(unsafe.Sizeof(*order)) + entryOverhead
+	size += int64(len(order.OrderUID) + len(order.TrackNumber) + len(order.Entry) + len(order.Locate) +
+		len(order.InternalSignature) + len(order.CustomerID) + len(order.DeliveryService) +
+		len(order.Shardkey) + len(order.OffShard) + len(order.Status))
+
+	d := &order.Delivery
+	size += int64(len(d.OrderUID) + len(d.Name) + len(d.Phone) + len(d.Zip) + len(d.City) +
+		len(d.Address) + len(d.Region) + len(d.Email))
+
+	p := &order.Payment
+	size += int64(len(p.OrderUID) + len(p.Transaction) + len(p.Type) + len(p.RequestID) + len(p.Currency) +
+		len(p.Provider) + len(p.Bank))
+
+	size += int64(cap(order.Payments)) * int64(unsafe.Sizeof(models.Payment{}))
+	for i := range order.Payments {
+		p := &order.Payments[i]
+		size += int64(len(p.OrderUID) + len(p.Transaction) + len(p.Type) + len(p.RequestID) + len(p.Currency) +
+			len(p.Provider) + len(p.Bank))
+	}
+
+	size += int64(cap(order.Item)) * int64(unsafe.Sizeof(models.Item{}))
+	for i := range order.Item {
+		it := &order.Item[i]
+		size += int64(len(it.OrderUID) + len(it.TrackNumber) + len(it.Rid) + len(it.NameItem) + len(it.Brand))
+	}
+
+	size += int64(cap(order.Warnings)) * int64(unsafe.Sizeof(models.OrderWarning{}))
+	for i := range order.Warnings {
+		w := &order.Warnings[i]
+		size += int64(len(w.Code) + len(w.Field) + len(w.Message))
+	}
+
+	return size
+}
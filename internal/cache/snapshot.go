@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"order-manager/internal/models"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Формат файла: magic (4 байта) | версия (1 байт) | crc32 данных | длина данных | gob-данные
+var snapshotMagic = [4]byte{'O', 'M', 'C', 'S'}
+
+// snapshotVersion увеличивается при каждом изменении models.Order: gob молча оставляет
+// новые поля нулевыми, и без смены версии кэш отдавал бы заказы без них.
+// 2 - payments, net_paid, status, version.
+const (
+	snapshotVersion    = 2
+	snapshotHeaderSize = len(snapshotMagic) + 1 + 4 + 8
+)
+
+var (
+	ErrSnapshotDisabled = errors.New("cache snapshot is disabled")
+	ErrSnapshotCorrupt  = errors.New("cache snapshot is corrupt")
+)
+
+type snapshot struct {
+	SavedAt time.Time
+	Entries []snapshotEntry
+}
+
+type snapshotEntry struct {
+	Order     models.Order
+	ExpiresAt time.Time
+}
+
+// SaveSnapshot атомарно записывает содержимое кэша на диск
+func (c *Cache) SaveSnapshot() error {
+	if c.snapshotPath == "" {
+		return ErrSnapshotDisabled
+	}
+
+	c.mu.Lock()
+	keys := c.policy.keys()
+	snap := snapshot{SavedAt: time.Now(), Entries: make([]snapshotEntry, 0, len(keys))}
+	for _, key := range keys {
+		if e, found := c.cacheList[key]; found {
+			snap.Entries = append(snap.Entries, snapshotEntry{Order: e.order, ExpiresAt: e.expiresAt})
+		}
+	}
+	c.mu.Unlock()
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(snap); err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic[:])
+	header[4] = snapshotVersion
+	binary.BigEndian.PutUint32(header[5:9], crc32.ChecksumIEEE(payload.Bytes()))
+	binary.BigEndian.PutUint64(header[9:17], uint64(payload.Len()))
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.snapshotPath), filepath.Base(c.snapshotPath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(header); err == nil {
+		_, err = tmp.Write(payload.Bytes())
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), c.snapshotPath)
+}
+
+// LoadSnapshot загружает кэш из файла и возвращает число загруженных заказов.
+// Просроченные записи пропускаются.
+func (c *Cache) LoadSnapshot() (int, error) {
+	if c.snapshotPath == "" {
+		return 0, ErrSnapshotDisabled
+	}
+
+	data, err := os.ReadFile(c.snapshotPath)
+	if err != nil {
+		return 0, err
+	}
+
+	snap, err := decodeSnapshot(data)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now, loaded := time.Now(), 0
+	for _, e := range snap.Entries {
+		if !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt) {
+			continue
+		}
+		c.setLocked(e.Order, e.ExpiresAt)
+		loaded++
+	}
+	return loaded, nil
+}
+
+func decodeSnapshot(data []byte) (*snapshot, error) {
+	if len(data) < snapshotHeaderSize || !bytes.Equal(data[:4], snapshotMagic[:]) {
+		return nil, ErrSnapshotCorrupt
+	}
+	if data[4] != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrSnapshotCorrupt, data[4])
+	}
+
+	checksum := binary.BigEndian.Uint32(data[5:9])
+	length := binary.BigEndian.Uint64(data[9:17])
+	payload := data[snapshotHeaderSize:]
+	if uint64(len(payload)) != length || crc32.ChecksumIEEE(payload) != checksum {
+		return nil, ErrSnapshotCorrupt
+	}
+
+	var snap snapshot
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotCorrupt, err)
+	}
+	return &snap, nil
+}
+
+// StartSnapshotter периодически сохраняет снапшот, пока не отменен ctx
+func (c *Cache) StartSnapshotter(ctx context.Context, log *slog.Logger) {
+	if c.snapshotPath == "" || c.snapshotInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.SaveSnapshot(); err != nil {
+				log.Error("Failed to save cache snapshot", slog.String("error", err.Error()))
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+type segment uint8
+
+const (
+	segmentWindow segment = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUItem struct {
+	key     string
+	segment segment
+}
+
+// tinyLFU реализует W-TinyLFU: новые ключи попадают в небольшое LRU-окно,
+// а в основную SLRU-область допускаются, только если по оценке частоты
+// обращений они "горячее" кандидата на вытеснение
+type tinyLFU struct {
+	sketch *countMinSketch
+	elems  map[string]*list.Element
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+
+	windowCap    int
+	mainCap      int
+	protectedCap int
+}
+
+func newTinyLFU(capacity int) *tinyLFU {
+	windowCap := max(capacity/100, 1)
+	mainCap := max(capacity-windowCap, 0)
+
+	return &tinyLFU{
+		sketch:       newCountMinSketch(capacity),
+		elems:        make(map[string]*list.Element, capacity),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: mainCap * 80 / 100,
+	}
+}
+
+func (p *tinyLFU) add(key string) (string, bool) {
+	if _, found := p.elems[key]; found {
+		p.access(key)
+		return "", false
+	}
+
+	p.sketch.increment(key)
+	p.elems[key] = p.window.PushFront(&tinyLFUItem{key: key, segment: segmentWindow})
+	if p.window.Len() <= p.windowCap {
+		return "", false
+	}
+
+	// последний ключ окна претендует на место в основной области
+	candidate := p.window.Remove(p.window.Back()).(*tinyLFUItem)
+	if p.probation.Len()+p.protected.Len() < p.mainCap {
+		p.pushProbation(candidate)
+		return "", false
+	}
+
+	victims := p.probation
+	if victims.Len() == 0 {
+		victims = p.protected
+	}
+	back := victims.Back()
+	if back == nil {
+		delete(p.elems, candidate.key)
+		return candidate.key, true
+	}
+
+	victim := back.Value.(*tinyLFUItem)
+	if p.sketch.estimate(candidate.key) > p.sketch.estimate(victim.key) {
+		victims.Remove(back)
+		delete(p.elems, victim.key)
+		p.pushProbation(candidate)
+		return victim.key, true
+	}
+
+	delete(p.elems, candidate.key)
+	return candidate.key, true
+}
+
+func (p *tinyLFU) access(key string) {
+	p.sketch.increment(key)
+
+	e, found := p.elems[key]
+	if !found {
+		return
+	}
+
+	item := e.Value.(*tinyLFUItem)
+	switch item.segment {
+	case segmentWindow:
+		p.window.MoveToFront(e)
+	case segmentProtected:
+		p.protected.MoveToFront(e)
+	case segmentProbation:
+		p.probation.Remove(e)
+		item.segment = segmentProtected
+		p.elems[key] = p.protected.PushFront(item)
+
+		if p.protected.Len() > p.protectedCap {
+			demoted := p.protected.Remove(p.protected.Back()).(*tinyLFUItem)
+			p.pushProbation(demoted)
+		}
+	}
+}
+
+func (p *tinyLFU) remove(key string) {
+	e, found := p.elems[key]
+	if !found {
+		return
+	}
+	p.segmentList(e.Value.(*tinyLFUItem).segment).Remove(e)
+	delete(p.elems, key)
+}
+
+func (p *tinyLFU) evict() (string, bool) {
+	for _, l := range []*list.List{p.probation, p.protected, p.window} {
+		if back := l.Back(); back != nil {
+			item := l.Remove(back).(*tinyLFUItem)
+			delete(p.elems, item.key)
+			return item.key, true
+		}
+	}
+	return "", false
+}
+
+func (p *tinyLFU) keys() []string {
+	keys := make([]string, 0, len(p.elems))
+	for _, l := range []*list.List{p.probation, p.window, p.protected} {
+		for e := l.Back(); e != nil; e = e.Prev() {
+			keys = append(keys, e.Value.(*tinyLFUItem).key)
+		}
+	}
+	return keys
+}
+
+func (p *tinyLFU) pushProbation(item *tinyLFUItem) {
+	item.segment = segmentProbation
+	p.elems[item.key] = p.probation.PushFront(item)
+}
+
+func (p *tinyLFU) segmentList(s segment) *list.List {
+	switch s {
+	case segmentWindow:
+		return p.window
+	case segmentProbation:
+		return p.probation
+	default:
+		return p.protected
+	}
+}
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+)
+
+// countMinSketch приближенно считает частоту обращений к ключам. Счетчики
+// периодически делятся пополам, чтобы старая популярность затухала.
+type countMinSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	seed      maphash.Seed
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	// ширина с запасом относительно емкости, чтобы коллизии редких ключей
+	// не давали им частоту, сравнимую с горячими
+	width := 16
+	for width < 8*capacity {
+		width <<= 1
+	}
+
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		seed:    maphash.MakeSeed(),
+		resetAt: 10 * max(capacity, 1),
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [sketchDepth]uint64 {
+	h := maphash.String(s.seed, key)
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		// для каждой строки свой перемешанный хеш (splitmix64), чтобы коллизии в строках были независимы
+		x := h + uint64(i+1)*0x9e3779b97f4a7c15
+		x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+		x = (x ^ x>>27) * 0x94d049bb133111eb
+		idx[i] = (x ^ x>>31) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < sketchMaxCounter {
+			s.rows[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	est := uint8(sketchMaxCounter)
+	for i, j := range s.indexes(key) {
+		est = min(est, s.rows[i][j])
+	}
+	return est
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
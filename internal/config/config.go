@@ -1,21 +1,71 @@
 package config
 
-import "github.com/ilyakaznacheev/cleanenv"
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
 
 type Config struct {
+	App
+	Tracing
 	Cache
 	Kafka
+	Outbox
 	Db
 	HttpServer
 }
 
+type App struct {
+	InstanceID         string        `env:"INSTANCE_ID"`
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT" env-default:"30s"`
+	HealthCheckTimeout time.Duration `env:"HEALTH_CHECK_TIMEOUT" env-default:"2s"`
+}
+
+type Tracing struct {
+	Exporter    string  `env:"TRACING_EXPORTER" env-default:"none"`
+	ServiceName string  `env:"OTEL_SERVICE_NAME" env-default:"order-manager"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+}
+
 type Cache struct {
-	Size int `env:"CACHE_SIZE" env-default:"100"`
+	Size            int           `env:"CACHE_SIZE" env-default:"100"`
+	Policy          string        `env:"CACHE_POLICY" env-default:"lru"`
+	TTL             time.Duration `env:"CACHE_TTL" env-default:"0s"`
+	MaxBytes        int64         `env:"CACHE_MAX_BYTES" env-default:"0"`
+	JanitorInterval time.Duration `env:"CACHE_JANITOR_INTERVAL" env-default:"1m"`
+	NegativeTTL     time.Duration `env:"CACHE_NEGATIVE_TTL" env-default:"30s"`
+	RefreshOnNotify bool          `env:"CACHE_REFRESH_ON_NOTIFY" env-default:"true"`
+
+	WarmStrategy      string        `env:"CACHE_WARM_STRATEGY" env-default:"newest"`
+	ReadTrackInterval time.Duration `env:"CACHE_READ_TRACK_INTERVAL" env-default:"1m"`
+
+	SnapshotPath     string        `env:"CACHE_SNAPSHOT_PATH"`
+	SnapshotInterval time.Duration `env:"CACHE_SNAPSHOT_INTERVAL" env-default:"5m"`
 }
 
 type Kafka struct {
-	Topic   string `env:"KAFKA_TOPIC"`
-	Brokers string `env:"KAFKA_BROKERS"`
+	Topic           string `env:"KAFKA_TOPIC"`
+	Brokers         string `env:"KAFKA_BROKERS"`
+	GroupID         string `env:"KAFKA_GROUP_ID" env-default:"0"`
+	DeadLetterTopic string `env:"KAFKA_DLQ_TOPIC"`
+	Concurrency     int    `env:"KAFKA_CONCURRENCY" env-default:"4"`
+
+	BatchSize   int           `env:"KAFKA_BATCH_SIZE" env-default:"100"`
+	BatchLinger time.Duration `env:"KAFKA_BATCH_LINGER" env-default:"50ms"`
+
+	RetryMaxAttempts     int           `env:"KAFKA_RETRY_MAX_ATTEMPTS" env-default:"5"`
+	RetryInitialInterval time.Duration `env:"KAFKA_RETRY_INITIAL_INTERVAL" env-default:"100ms"`
+	RetryMaxInterval     time.Duration `env:"KAFKA_RETRY_MAX_INTERVAL" env-default:"5s"`
+	RetryMaxElapsed      time.Duration `env:"KAFKA_RETRY_MAX_ELAPSED" env-default:"30s"`
+}
+
+type Outbox struct {
+	Topic           string        `env:"OUTBOX_TOPIC" env-default:"order-events"`
+	BatchSize       int           `env:"OUTBOX_BATCH_SIZE" env-default:"100"`
+	PollInterval    time.Duration `env:"OUTBOX_POLL_INTERVAL" env-default:"1s"`
+	CleanupInterval time.Duration `env:"OUTBOX_CLEANUP_INTERVAL" env-default:"1h"`
+	Retention       time.Duration `env:"OUTBOX_RETENTION" env-default:"24h"`
 }
 
 type Db struct {
@@ -25,10 +75,18 @@ type Db struct {
 	Host     string `env:"POSTGRES_HOST"`
 	Port     string `env:"POSTGRES_PORT"`
 	Ssl      string `env:"POSTGRES_SSL"`
+
+	QueryTimeout time.Duration `env:"POSTGRES_QUERY_TIMEOUT" env-default:"5s"`
+	WriteTimeout time.Duration `env:"POSTGRES_WRITE_TIMEOUT" env-default:"10s"`
 }
 
 type HttpServer struct {
 	Addr string `env:"HTTP_ADDRESS"`
+
+	ReadTimeout    time.Duration `env:"HTTP_READ_TIMEOUT" env-default:"10s"`
+	WriteTimeout   time.Duration `env:"HTTP_WRITE_TIMEOUT" env-default:"30s"`
+	IdleTimeout    time.Duration `env:"HTTP_IDLE_TIMEOUT" env-default:"60s"`
+	RequestTimeout time.Duration `env:"HTTP_REQUEST_TIMEOUT" env-default:"15s"`
 }
 
 func LoadConfig() (Config, error) {
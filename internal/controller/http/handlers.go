@@ -1,17 +1,31 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"order-manager/internal/models"
+	"order-manager/pkg/errorx"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 )
 
 type service interface {
-	GetOrderByUID(string) (*models.Order, error)
-	SaveOrder(*models.Order) error
+	GetOrderByUID(context.Context, string) (*models.Order, error)
+	SaveOrder(context.Context, *models.Order) error
+	ListOrders(context.Context, models.OrderFilter) (*models.OrderList, error)
+	BeginIdempotentRequest(context.Context, string, string) (*models.IdempotencyRecord, error)
+	CompleteIdempotentRequest(context.Context, string, int, map[string]string, []byte) error
+	ChangeOrderStatus(context.Context, string, models.StatusUpdate) (*models.Order, error)
+	GetOrderHistory(context.Context, string) ([]models.OrderVersion, error)
+	DiffOrderVersions(context.Context, string, int, int) (*models.OrderDiff, error)
 }
 
 type Handler struct {
@@ -29,19 +43,323 @@ func NewHandler(s service, log *slog.Logger) *Handler {
 // @Summary Get order by UID
 // @Param order_uid path string true "Order UID"
 // @Success 200 {object} models.Order
+// @Header 200 {string} ETag "Order version"
 // @Failure 400 {object} error "Bad request"
 // @Failure 404 {object} error "Not found"
+// @Failure 500 {object} error "Internal error"
+// @Failure 503 {object} error "Request canceled"
+// @Failure 504 {object} error "Request timed out"
 // @Router /order/{order_uid} [get]
 func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "order_uid")
 
-	order, err := h.s.GetOrderByUID(id)
+	order, err := h.s.GetOrderByUID(r.Context(), id)
 	if err != nil {
+		switch {
+		case errors.Is(err, errorx.ErrOrderNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		case errors.Is(err, context.Canceled):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setETag(w, order)
+	writeJSON(w, http.StatusOK, order)
+}
+
+// @Summary Create or update order
+// @Accept json
+// @Produce json
+// @Param order body models.Order true "Order"
+// @Param Idempotency-Key header string false "Idempotency key"
+// @Param If-Match header string false "Expected order version (ETag)"
+// @Success 201 {object} models.Order
+// @Header 201 {string} ETag "New order version"
+// @Failure 400 {object} error "Bad request"
+// @Failure 409 {object} error "Idempotency key conflict or item/payment belongs to another order"
+// @Failure 412 {object} error "Order version does not match If-Match"
+// @Failure 422 {object} errorx.ValidationError "Validation error"
+// @Failure 500 {object} error "Internal error"
+// @Router /orders [post]
+func (h *Handler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		http.Error(w, fmt.Sprintf("invalid order json: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, err := withSource(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.s.SaveOrder(ctx, &order)
+	if err != nil {
+		var verr *errorx.ValidationError
+		switch {
+		case errors.As(err, &verr):
+			writeJSON(w, http.StatusUnprocessableEntity, verr)
+		case errors.Is(err, errorx.ErrOrderValidation):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, errorx.ErrItemConflict), errors.Is(err, errorx.ErrPaymentConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, errorx.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Location", "/order/"+order.OrderUID)
+	setETag(w, &order)
+	writeJSON(w, http.StatusCreated, order)
+}
+
+// @Summary Change order status
+// @Description Allowed transitions: created -> paid|cancelled, paid -> assembling|cancelled,
+// @Description assembling -> shipped|cancelled, shipped -> delivered|returned, delivered -> returned
+// @Accept json
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Param update body models.StatusUpdate true "New status"
+// @Param If-Match header string false "Expected order version (ETag)"
+// @Param Idempotency-Key header string false "Idempotency key"
+// @Success 200 {object} models.Order
+// @Header 200 {string} ETag "New order version"
+// @Failure 400 {object} error "Bad request"
+// @Failure 404 {object} error "Not found"
+// @Failure 409 {object} error "Transition not allowed"
+// @Failure 412 {object} error "Order version does not match If-Match"
+// @Failure 422 {object} errorx.ValidationError "Unknown status"
+// @Failure 500 {object} error "Internal error"
+// @Router /orders/{order_uid}/status [patch]
+func (h *Handler) ChangeOrderStatus(w http.ResponseWriter, r *http.Request) {
+	var update models.StatusUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, fmt.Sprintf("invalid status json: %s", err), http.StatusBadRequest)
+		return
+	}
+	if update.Source == "" {
+		update.Source = models.SourceHTTP
+	}
+
+	ctx, err := withSource(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.s.ChangeOrderStatus(ctx, chi.URLParam(r, "order_uid"), update)
+	if err != nil {
+		var verr *errorx.ValidationError
+		switch {
+		case errors.As(err, &verr):
+			writeJSON(w, http.StatusUnprocessableEntity, verr)
+		case errors.Is(err, errorx.ErrOrderNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errorx.ErrStatusTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, errorx.ErrVersionConflict):
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	setETag(w, order)
+	writeJSON(w, http.StatusOK, order)
+}
+
+// @Summary Get order change history
+// @Description Versions in ascending order, each with a full order snapshot
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Success 200 {array} models.OrderVersion
+// @Failure 404 {object} error "Not found"
+// @Failure 500 {object} error "Internal error"
+// @Router /orders/{order_uid}/history [get]
+func (h *Handler) GetOrderHistory(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.s.GetOrderHistory(r.Context(), chi.URLParam(r, "order_uid"))
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// @Summary Diff two order versions
+// @Description Field-level diff; items are matched by rid and payments by transaction
+// @Produce json
+// @Param order_uid path string true "Order UID"
+// @Param from query int false "Base version (default: the one before to, 0 - empty order)"
+// @Param to query int false "Target version (default: latest)"
+// @Success 200 {object} models.OrderDiff
+// @Failure 400 {object} error "Bad request"
+// @Failure 404 {object} error "Not found"
+// @Failure 500 {object} error "Internal error"
+// @Router /orders/{order_uid}/diff [get]
+func (h *Handler) DiffOrderVersions(w http.ResponseWriter, r *http.Request) {
+	from, err := parseVersion(r, "from", -1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseVersion(r, "to", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	diff, err := h.s.DiffOrderVersions(r.Context(), chi.URLParam(r, "order_uid"), from, to)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, diff)
+}
+
+func parseVersion(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid %s: must be a non-negative integer", name)
+	}
+	return version, nil
+}
+
+func writeLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errorx.ErrOrderNotFound) || errors.Is(err, errorx.ErrVersionNotFound) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// withSource помечает изменения, сделанные запросом, его request id для истории версий
+// и ожидаемой версией заказа из If-Match
+func withSource(r *http.Request) (context.Context, error) {
+	expected, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		return nil, err
+	}
+	return models.WithChangeSource(r.Context(), models.ChangeSource{
+		Kind:            models.SourceHTTP,
+		Ref:             middleware.GetReqID(r.Context()),
+		ExpectedVersion: expected,
+	}), nil
+}
+
+// parseIfMatch принимает ETag вида "3" или W/"3"; пустой заголовок и * - без проверки версии
+func parseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	version, err := strconv.Atoi(tag)
+	if err != nil || version <= 0 {
+		return 0, fmt.Errorf("invalid If-Match: expected order version ETag, got %s", header)
+	}
+	return version, nil
+}
+
+func setETag(w http.ResponseWriter, order *models.Order) {
+	if order.Version > 0 {
+		w.Header().Set("ETag", strconv.Quote(strconv.Itoa(order.Version)))
+	}
+}
+
+// @Summary List orders
+// @Description Keyset pagination ordered by date_created desc, order_uid desc
+// @Param customer_id query string false "Customer ID"
+// @Param track_number query string false "Track number"
+// @Param delivery_service query string false "Delivery service"
+// @Param entry query string false "Entry"
+// @Param locale query string false "Locale"
+// @Param date_from query string false "Created at or after (RFC3339)"
+// @Param date_to query string false "Created before (RFC3339)"
+// @Param cursor query string false "Next cursor from previous page"
+// @Param limit query int false "Page size (max 100)"
+// @Success 200 {object} models.OrderList
+// @Failure 400 {object} error "Bad request"
+// @Failure 500 {object} error "Internal error"
+// @Router /orders [get]
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.s.ListOrders(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func parseOrderFilter(r *http.Request) (models.OrderFilter, error) {
+	q := r.URL.Query()
+	filter := models.OrderFilter{
+		CustomerID:      q.Get("customer_id"),
+		TrackNumber:     q.Get("track_number"),
+		DeliveryService: q.Get("delivery_service"),
+		Entry:           q.Get("entry"),
+		Locale:          q.Get("locale"),
+	}
+
+	if v := q.Get("date_from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid date_from: %w", err)
+		}
+		// date_created хранится в UTC без зоны, а pgx отбрасывает зону при записи в TIMESTAMP
+		t = t.UTC()
+		filter.DateFrom = &t
+	}
+	if v := q.Get("date_to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid date_to: %w", err)
+		}
+		t = t.UTC()
+		filter.DateTo = &t
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("invalid limit: %s", v)
+		}
+		filter.Limit = limit
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := models.DecodeCursor(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
 
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(order)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
@@ -0,0 +1,43 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"order-manager/internal/health"
+)
+
+type readinessChecker interface {
+	Check(context.Context) health.Report
+}
+
+type HealthHandler struct {
+	ready readinessChecker
+}
+
+func NewHealthHandler(ready readinessChecker) *HealthHandler {
+	return &HealthHandler{ready: ready}
+}
+
+// @Summary Liveness probe
+// @Produce json
+// @Success 200 {object} health.Report
+// @Router /healthz [get]
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, health.Report{Status: health.StatusUp})
+}
+
+// @Summary Readiness probe
+// @Description Checks database, kafka brokers, consumer group membership and cache warm-up
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.ready.Check(r.Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"order-manager/pkg/errorx"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotentBody    = 10 << 20
+)
+
+// заголовки ответа, которые сохраняются и отдаются при повторе запроса
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (h *Handler) Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.New()
+		sum.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		sum.Write(body)
+		requestHash := hex.EncodeToString(sum.Sum(nil))
+
+		record, err := h.s.BeginIdempotentRequest(r.Context(), key, requestHash)
+		if err != nil {
+			if errors.Is(err, errorx.ErrIdempotencyKeyReused) || errors.Is(err, errorx.ErrIdempotencyKeyInProgress) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if record != nil {
+			for name, value := range record.Headers {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		headers := make(map[string]string, len(replayedHeaders))
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		// ответ уже отправлен, поэтому сохраняем его, даже если клиент успел отключиться
+		h.s.CompleteIdempotentRequest(context.WithoutCancel(r.Context()), key, rec.status, headers, rec.body.Bytes())
+	})
+}
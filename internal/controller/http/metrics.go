@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"order-manager/internal/metrics"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// instrument считает запросы и их длительность по шаблону маршрута, а не по
+// фактическому пути, чтобы order_uid не раздувал число меток
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := []string{r.Method, route, strconv.Itoa(status)}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
@@ -1,7 +1,11 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"order-manager/internal/config"
+	"order-manager/internal/metrics"
 
 	_ "order-manager/docs"
 
@@ -14,26 +18,52 @@ type Server struct {
 	httpServer *http.Server
 }
 
-func NewServer(handler *Handler, addr string) *Server {
+func NewServer(handler *Handler, healthHandler *HealthHandler, cfg config.HttpServer) *Server {
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
+	router.Use(instrument)
+	router.Use(traceRequests)
+	if cfg.RequestTimeout > 0 {
+		router.Use(middleware.Timeout(cfg.RequestTimeout))
+	}
 
 	router.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("http://localhost:8081/swagger/doc.json"),
 	))
 
+	router.Handle("/metrics", metrics.Handler())
+	router.Get("/healthz", healthHandler.Healthz)
+	router.Get("/readyz", healthHandler.Readyz)
+
 	router.Get("/order/{order_uid}", handler.GetOrder)
+	router.Get("/orders", handler.ListOrders)
+	router.With(handler.Idempotency).Post("/orders", handler.CreateOrder)
+	router.With(handler.Idempotency).Patch("/orders/{order_uid}/status", handler.ChangeOrderStatus)
+	router.Get("/orders/{order_uid}/history", handler.GetOrderHistory)
+	router.Get("/orders/{order_uid}/diff", handler.DiffOrderVersions)
 
 	router.Handle("/*", http.StripPrefix("/", http.FileServer(http.Dir("./pkg/web"))))
 
 	return &Server{
 		httpServer: &http.Server{
-			Addr:    addr,
-			Handler: router,
+			Addr:         cfg.Addr,
+			Handler:      router,
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
 		},
 	}
 }
 
 func (s *Server) StartHttpServer() error {
-	return s.httpServer.ListenAndServe()
+	err := s.httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown перестает принимать соединения и ждет завершения текущих запросов
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
 }
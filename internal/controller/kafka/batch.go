@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"order-manager/internal/models"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type batchEntry struct {
+	m     kafka.Message
+	order *models.Order
+	src   models.ChangeSource
+	// позиция сообщения в обрабатываемой пачке
+	pos int
+}
+
+// collectBatch ждет первое сообщение, затем добирает пачку до batchSize или
+// пока не истечет batchLinger. false означает, что канал закрыт.
+func (c *Consumer) collectBatch(ctx context.Context, messages <-chan inbound) ([]inbound, bool) {
+	var first inbound
+	select {
+	case m, ok := <-messages:
+		if !ok {
+			return nil, false
+		}
+		first = m
+	case <-ctx.Done():
+		return nil, true
+	}
+
+	batch := make([]inbound, 1, c.batchSize)
+	batch[0] = first
+	if c.batchSize == 1 {
+		return batch, true
+	}
+
+	timer := time.NewTimer(c.batchLinger)
+	defer timer.Stop()
+
+	for len(batch) < c.batchSize {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, m)
+		case <-timer.C:
+			return batch, true
+		case <-ctx.Done():
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+// handleBatch обрабатывает пачку сообщений одной партиции и возвращает те, которые
+// можно коммитить, и необработанный хвост, начиная с первого сообщения, которое коммитить
+// нельзя: следующие за ним сообщения не обрабатываются, чтобы не нарушить порядок внутри
+// партиции. Смена статуса и отклоненные сообщения разбивают пачку: заказы перед ними
+// сохраняются первыми.
+func (c *Consumer) handleBatch(ctx context.Context, messages []inbound) (done []kafka.Message, pending []inbound) {
+	ctx, span := startProcessSpan(ctx, messages)
+	defer span.End()
+
+	done = make([]kafka.Message, 0, len(messages))
+	entries := make([]batchEntry, 0, len(messages))
+
+	// flush сохраняет накопленные заказы; false означает, что сохранены не все
+	flush := func() bool {
+		saved := c.saveBatch(ctx, entries)
+		done = append(done, saved...)
+		if len(saved) < len(entries) {
+			pending = messages[entries[len(saved)].pos:]
+			return false
+		}
+		entries = entries[:0]
+		return true
+	}
+	// reject отправляет сообщение в dead-letter после сохранения предшествующих заказов
+	reject := func(i int, class string, cause error) bool {
+		if !flush() {
+			return false
+		}
+		if c.sendToDeadLetter(ctx, messages[i].Message, class, cause) != nil {
+			pending = messages[i:]
+			return false
+		}
+		done = append(done, messages[i].Message)
+		return true
+	}
+
+	for i, in := range messages {
+		m := in.Message
+		if messageType(m) == messageTypeStatus {
+			if !flush() {
+				return done, pending
+			}
+			if c.handleStatusUpdate(ctx, m) != nil {
+				return done, messages[i:]
+			}
+			done = append(done, m)
+			continue
+		}
+
+		order, err := c.decode(m)
+		if err != nil {
+			if !reject(i, errorClassUnmarshal, err) {
+				return done, pending
+			}
+			continue
+		}
+
+		src, err := messageSource(m)
+		if err == nil {
+			err = c.s.ValidateOrder(order)
+		}
+		if err != nil {
+			if !reject(i, errorClassValidation, err) {
+				return done, pending
+			}
+			continue
+		}
+
+		entries = append(entries, batchEntry{m: m, order: order, src: src, pos: i})
+	}
+
+	flush()
+	return done, pending
+}
+
+// saveBatch сохраняет заказы пачки одной транзакцией и возвращает сообщения, которые
+// можно коммитить. Это всегда начало entries: на первом сообщении, которое коммитить
+// нельзя, обработка останавливается.
+func (c *Consumer) saveBatch(ctx context.Context, entries []batchEntry) []kafka.Message {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	orders := make([]*models.Order, len(entries))
+	sources := make([]models.ChangeSource, len(entries))
+	for i, e := range entries {
+		orders[i] = e.order
+		sources[i] = e.src
+	}
+	saveCtx := models.WithOrderChangeSources(ctx, sources)
+
+	first, last := entries[0].m, entries[len(entries)-1].m
+	attrs := []any{slog.Int("Partition", first.Partition), slog.Int("FirstOffset", int(first.Offset)),
+		slog.Int("LastOffset", int(last.Offset)), slog.Int("Size", len(orders))}
+
+	done := make([]kafka.Message, 0, len(entries))
+	err := c.retry(ctx, attrs, isTransient, func() error {
+		return c.s.SaveOrders(saveCtx, orders)
+	})
+	switch {
+	case err == nil:
+		for _, e := range entries {
+			done = append(done, e.m)
+		}
+	case ctx.Err() != nil:
+	case isTransient(err):
+		for _, e := range entries {
+			if c.sendToDeadLetter(ctx, e.m, errorClassInternal, err) != nil {
+				break
+			}
+			done = append(done, e.m)
+		}
+	default:
+		// пачка отклонена целиком - сохраняем по одному, чтобы отсеять конкретные сообщения
+		c.log.Warn("Batch rejected, falling back to single saves", append(attrs, slog.String("Error", err.Error()))...)
+		for _, e := range entries {
+			if c.handleOrder(ctx, e.m, e.order, e.src) != nil {
+				break
+			}
+			done = append(done, e.m)
+		}
+	}
+
+	return done
+}
@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"order-manager/internal/models"
+	"order-manager/pkg/errorx"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sourceService запоминает источники, с которыми сохранялась пачка
+type sourceService struct {
+	blockingService
+	sources []models.ChangeSource
+}
+
+func (s *sourceService) SaveOrders(ctx context.Context, orders []*models.Order) error {
+	for i := range orders {
+		s.sources = append(s.sources, models.ChangeSourceFrom(ctx, i))
+	}
+	return nil
+}
+
+func TestSaveBatch_SourcePerMessage(t *testing.T) {
+	t.Parallel()
+
+	s := &sourceService{}
+	c := newTestConsumer(&fakeReader{}, s)
+
+	// два сообщения одного заказа в пачке: у каждой версии свой offset и ожидаемая версия
+	entries := []batchEntry{
+		{m: kafka.Message{Offset: 10}, order: &models.Order{OrderUID: "a"},
+			src: models.ChangeSource{Kind: models.SourceKafka, Ref: "orders/0/10", ExpectedVersion: 1}},
+		{m: kafka.Message{Offset: 11}, order: &models.Order{OrderUID: "a"},
+			src: models.ChangeSource{Kind: models.SourceKafka, Ref: "orders/0/11", ExpectedVersion: 2}},
+	}
+
+	done := c.saveBatch(context.Background(), entries)
+	require.Len(t, done, 2)
+	assert.Equal(t, []models.ChangeSource{entries[0].src, entries[1].src}, s.sources)
+}
+
+// failingService отвечает внутренней ошибкой на первые failures сохранений
+// и запоминает, что было применено
+type failingService struct {
+	blockingService
+	mu       sync.Mutex
+	failures int
+	saved    [][]string
+	statuses []string
+}
+
+func (s *failingService) SaveOrders(_ context.Context, orders []*models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		return fmt.Errorf("save: %w", errorx.ErrInternal)
+	}
+	uids := make([]string, len(orders))
+	for i, o := range orders {
+		uids[i] = o.OrderUID
+	}
+	s.saved = append(s.saved, uids)
+	return nil
+}
+
+func (s *failingService) ChangeOrderStatus(_ context.Context, orderUID string, _ models.StatusUpdate) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, orderUID)
+	return nil, nil
+}
+
+func orderMessage(offset int64, orderUID string) inbound {
+	return inbound{Message: kafka.Message{Topic: "orders", Offset: offset, Value: []byte(`{"order_uid":"` + orderUID + `"}`)}}
+}
+
+func TestHandleBatch_StopsAtUncommittable(t *testing.T) {
+	t.Parallel()
+
+	// dead-letter не настроен: не сохраненный из-за сбоя заказ коммитить нельзя
+	s := &failingService{failures: 1}
+	c := newTestConsumer(&fakeReader{}, s)
+
+	status := inbound{Message: kafka.Message{Topic: "orders", Offset: 2, Value: []byte(`{"order_uid":"a","status":"paid"}`),
+		Headers: []kafka.Header{{Key: headerMessageType, Value: []byte(messageTypeStatus)}}}}
+	messages := []inbound{orderMessage(1, "a"), status, orderMessage(3, "b")}
+
+	done, pending := c.handleBatch(context.Background(), messages)
+
+	assert.Empty(t, done)
+	assert.Equal(t, messages, pending)
+	// следующие за ним сообщения не применяются раньше него
+	assert.Empty(t, s.statuses)
+	assert.Empty(t, s.saved)
+}
+
+func TestProcessBatch_PausesAndRetries(t *testing.T) {
+	t.Parallel()
+
+	r := &fakeReader{}
+	s := &failingService{failures: 1}
+	c := newTestConsumer(r, s)
+	c.batchSize = 2
+
+	w := &partitionWorker{topic: "orders", tracker: newOffsetTracker()}
+	batch := []inbound{orderMessage(1, "a"), orderMessage(2, "b")}
+	for _, m := range batch {
+		w.tracker.add(m.Offset)
+	}
+
+	c.processBatch(context.Background(), w, batch)
+
+	assert.Equal(t, [][]string{{"a", "b"}}, s.saved)
+	commits := r.commits()
+	require.Len(t, commits, 1)
+	assert.EqualValues(t, 2, commits[0].Offset)
+}
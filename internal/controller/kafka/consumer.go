@@ -4,86 +4,242 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"order-manager/internal/config"
+	"order-manager/internal/metrics"
 	"order-manager/internal/models"
+	"order-manager/internal/tracing"
 	"order-manager/pkg/errorx"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type service interface {
-	GetOrderByUID(string) (*models.Order, error)
-	SaveOrder(*models.Order) error
+	GetOrderByUID(context.Context, string) (*models.Order, error)
+	SaveOrder(context.Context, *models.Order) error
+	SaveOrders(context.Context, []*models.Order) error
+	ValidateOrder(*models.Order) error
+	ChangeOrderStatus(context.Context, string, models.StatusUpdate) (*models.Order, error)
+}
+
+type reader interface {
+	FetchMessage(context.Context) (kafka.Message, error)
+	CommitMessages(context.Context, ...kafka.Message) error
+	Close() error
 }
 
 type Consumer struct {
-	reader *kafka.Reader
-	s      service
-	log    *slog.Logger
+	reader     reader
+	deadLetter writer
+	dialer     *kafka.Dialer
+	admin      *kafka.Client
+	brokers    []string
+	groupID    string
+	s          service
+	log        *slog.Logger
+	backoff    backoff
+
+	batchSize   int
+	batchLinger time.Duration
+
+	sem     chan struct{}
+	workers map[int]*partitionWorker
+	wg      sync.WaitGroup
+
+	// чтение и обработка останавливаются раздельно: при остановке уже полученные
+	// сообщения дообрабатываются, пока не истечет время на завершение
+	fetchCtx  context.Context
+	stopFetch context.CancelFunc
+	procCtx   context.Context
+	abort     context.CancelFunc
+	stopped   chan struct{}
 }
 
-// конфиг
-func NewConsumer(s service, log *slog.Logger, topic string, brokers string) *Consumer {
-	brokersList := strings.Split(brokers, ",")
+func NewConsumer(s service, log *slog.Logger, cfg config.Kafka, instanceID string) *Consumer {
+	brokersList := strings.Split(cfg.Brokers, ",")
+	// уникальный client.id позволяет найти эту реплику среди участников группы
+	dialer := &kafka.Dialer{
+		ClientID:  "order-manager-" + instanceID,
+		Timeout:   10 * time.Second,
+		DualStack: true,
+	}
 	r := kafka.NewReader(kafka.ReaderConfig{
 		Brokers: brokersList,
-		Topic:   topic,
-		GroupID: "0",
+		Topic:   cfg.Topic,
+		GroupID: cfg.GroupID,
+		Dialer:  dialer,
 	})
+	admin := &kafka.Client{
+		Addr:      kafka.TCP(brokersList...),
+		Transport: &kafka.Transport{ClientID: dialer.ClientID},
+	}
+
+	c := &Consumer{
+		reader:      r,
+		dialer:      dialer,
+		admin:       admin,
+		brokers:     brokersList,
+		groupID:     cfg.GroupID,
+		s:           s,
+		log:         log,
+		backoff:     newBackoff(cfg),
+		batchSize:   max(cfg.BatchSize, 1),
+		batchLinger: cfg.BatchLinger,
+		sem:         make(chan struct{}, max(cfg.Concurrency, 1)),
+		workers:     make(map[int]*partitionWorker),
+		stopped:     make(chan struct{}),
+	}
+	c.fetchCtx, c.stopFetch = context.WithCancel(context.Background())
+	c.procCtx, c.abort = context.WithCancel(context.Background())
 
-	return &Consumer{
-		reader: r,
-		s:      s,
-		log:    log,
+	if cfg.DeadLetterTopic != "" {
+		c.deadLetter = &kafka.Writer{
+			Addr:         kafka.TCP(brokersList...),
+			Topic:        cfg.DeadLetterTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// сообщения пишутся по одному и синхронно: с таймаутом по умолчанию (1с)
+			// каждое отклоненное сообщение задерживало бы воркер партиции
+			BatchTimeout: 10 * time.Millisecond,
+		}
 	}
+
+	return c
 }
 
+// Start читает сообщения и раздает их воркерам партиций: внутри партиции
+// порядок сохраняется, разные партиции обрабатываются параллельно
 func (c *Consumer) Start(ctx context.Context) {
 	c.log.Info("Starting kafka consumer")
+	defer close(c.stopped)
+	defer c.stopWorkers()
+
+	// отмена ctx только прекращает чтение, обработку завершает Shutdown
+	stop := context.AfterFunc(ctx, c.stopFetch)
+	defer stop()
+
 	for {
 		select {
-		case <-ctx.Done():
+		case <-c.fetchCtx.Done():
 			return
 		default:
-			m, err := c.reader.FetchMessage(ctx)
+			m, err := c.reader.FetchMessage(c.fetchCtx)
 			if err != nil {
 				break
 			}
 
 			c.log.Info("Got message from kafka", slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)))
+			partition := strconv.Itoa(m.Partition)
+			metrics.KafkaConsumed.WithLabelValues(m.Topic, partition).Inc()
+			metrics.KafkaLag.WithLabelValues(m.Topic, partition).Set(float64(max(m.HighWaterMark-m.Offset-1, 0)))
 
-			new_order := models.Order{}
-			err = json.Unmarshal(m.Value, &new_order)
-			if err != nil {
-				c.log.Error("Failed to unmarshal message")
-				continue
-			}
+			msgCtx := otel.GetTextMapPropagator().Extract(ctx, tracing.KafkaCarrier{Headers: &m.Headers})
+			c.dispatch(c.fetchCtx, inbound{Message: m, spanCtx: trace.SpanContextFromContext(msgCtx)})
+		}
+	}
+}
 
-			err = c.s.SaveOrder(&new_order)
-			if err != nil {
-				c.log.Warn("Not saved order", slog.String("Error", err.Error()))
-				if errors.Is(err, errorx.ErrOrderValidation) {
-					err = c.reader.CommitMessages(ctx, m)
-					if err != nil {
-						c.log.Error("Failed to commit message", slog.String("Error", err.Error()))
-					}
-				}
-				continue
-			}
+func (c *Consumer) commit(ctx context.Context, m kafka.Message) bool {
+	err := c.reader.CommitMessages(ctx, m)
+	if err != nil {
+		c.log.Error("Failed to commit message", slog.String("Error", err.Error()))
+		return false
+	}
+	c.log.Info("Commited messsage", slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)))
+	return true
+}
 
-			err = c.reader.CommitMessages(ctx, m)
-			if err != nil {
-				c.log.Error("Failed to commit message", slog.String("Error", err.Error()))
-			} else {
-				c.log.Info("Commited messsage")
-			}
+func (c *Consumer) decode(m kafka.Message) (*models.Order, error) {
+	new_order := models.Order{}
+	err := json.Unmarshal(m.Value, &new_order)
+	if err != nil {
+		c.log.Error("Failed to unmarshal message", slog.String("Error", err.Error()))
+		return nil, err
+	}
+	return &new_order, nil
+}
+
+// handleOrder сохраняет один заказ. Возвращает ошибку, если сообщение нельзя коммитить.
+func (c *Consumer) handleOrder(ctx context.Context, m kafka.Message, order *models.Order, src models.ChangeSource) error {
+	attrs := []any{slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)), slog.String("order_uid", order.OrderUID)}
+	saveCtx := models.WithChangeSource(ctx, src)
+	err := c.retry(ctx, attrs, isTransient, func() error {
+		return c.s.SaveOrder(saveCtx, order)
+	})
+	if err != nil {
+		c.log.Warn("Not saved order", slog.String("Error", err.Error()))
+		switch {
+		case errors.Is(err, errorx.ErrOrderValidation):
+			return c.sendToDeadLetter(ctx, m, errorClassValidation, err)
+		case errors.Is(err, errorx.ErrItemConflict), errors.Is(err, errorx.ErrPaymentConflict):
+			return c.sendToDeadLetter(ctx, m, errorClassConflict, err)
+		case errors.Is(err, errorx.ErrVersionConflict):
+			return c.sendToDeadLetter(ctx, m, errorClassVersion, err)
+		case isTransient(err):
+			return c.sendToDeadLetter(ctx, m, errorClassInternal, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// headerExpectedVersion - необязательная версия заказа, на основе которой сделано
+// изменение; устаревшее сообщение отклоняется, а не перезаписывает более новый заказ
+const headerExpectedVersion = "expected-version"
+
+// messageSource ссылается на сообщение, из которого пришло изменение заказа
+func messageSource(m kafka.Message) (models.ChangeSource, error) {
+	src := models.ChangeSource{Kind: models.SourceKafka, Ref: fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset)}
+	for _, h := range m.Headers {
+		if h.Key != headerExpectedVersion {
+			continue
+		}
+		version, err := strconv.Atoi(string(h.Value))
+		if err != nil || version <= 0 {
+			return src, fmt.Errorf("invalid %s header %q", headerExpectedVersion, h.Value)
 		}
+		src.ExpectedVersion = version
 	}
+	return src, nil
 }
 
-func (c *Consumer) Stop() error {
+func isTransient(err error) bool {
+	return errors.Is(err, errorx.ErrInternal)
+}
+
+// Shutdown прекращает чтение новых сообщений, дожидается обработки уже полученных
+// и коммита их offset'ов. Если ctx истекает раньше, обработка прерывается -
+// незакоммиченные сообщения будут перечитаны после перезапуска.
+func (c *Consumer) Shutdown(ctx context.Context) error {
 	c.log.Info("Consumer is stopping")
+	c.stopFetch()
+
+	select {
+	case <-c.stopped:
+		c.log.Info("In-flight messages drained")
+	case <-ctx.Done():
+		c.log.Warn("Drain timed out, aborting in-flight messages")
+		c.abort()
+		<-c.stopped
+	}
+	c.abort()
+
+	if transport, ok := c.admin.Transport.(*kafka.Transport); ok {
+		transport.CloseIdleConnections()
+	}
+	if c.deadLetter != nil {
+		if err := c.deadLetter.Close(); err != nil {
+			c.log.Error("Failed to stop dead letter writer", slog.String("Error", err.Error()))
+		}
+	}
 	if err := c.reader.Close(); err != nil {
 		c.log.Error("Failed to stop reader", slog.String("Error", err.Error()))
 		return err
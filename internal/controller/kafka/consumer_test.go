@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"order-manager/internal/models"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageSource(t *testing.T) {
+	t.Parallel()
+
+	m := kafka.Message{Topic: "orders", Partition: 2, Offset: 42}
+	src, err := messageSource(m)
+	require.NoError(t, err)
+	assert.Equal(t, models.ChangeSource{Kind: models.SourceKafka, Ref: "orders/2/42"}, src)
+
+	m.Headers = []kafka.Header{{Key: headerExpectedVersion, Value: []byte("7")}}
+	src, err = messageSource(m)
+	require.NoError(t, err)
+	assert.Equal(t, 7, src.ExpectedVersion)
+
+	for _, value := range []string{"", "0", "-1", "v7"} {
+		m.Headers = []kafka.Header{{Key: headerExpectedVersion, Value: []byte(value)}}
+		_, err = messageSource(m)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestMessageType(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, messageTypeOrder, messageType(kafka.Message{}))
+	assert.Equal(t, messageTypeStatus, messageType(kafka.Message{
+		Headers: []kafka.Header{{Key: headerMessageType, Value: []byte(messageTypeStatus)}},
+	}))
+}
+
+type fakeReader struct {
+	mu        sync.Mutex
+	pending   []kafka.Message
+	committed []kafka.Message
+}
+
+// FetchMessage отдает заготовленные сообщения, затем ждет отмены ctx, как reader без новых сообщений
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.pending) > 0 {
+		m := r.pending[0]
+		r.pending = r.pending[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, msgs...)
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) commits() []kafka.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kafka.Message(nil), r.committed...)
+}
+
+// blockingService сообщает о начале сохранения в started и держит его,
+// пока не закрыт release или не отменен контекст обработки
+type blockingService struct {
+	started chan struct{}
+	release chan struct{}
+	result  chan error
+}
+
+func newBlockingService() *blockingService {
+	return &blockingService{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		result:  make(chan error, 1),
+	}
+}
+
+func (s *blockingService) SaveOrders(ctx context.Context, _ []*models.Order) error {
+	close(s.started)
+	var err error
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.result <- err
+	return err
+}
+
+func (s *blockingService) SaveOrder(ctx context.Context, o *models.Order) error {
+	return s.SaveOrders(ctx, []*models.Order{o})
+}
+
+func (s *blockingService) GetOrderByUID(context.Context, string) (*models.Order, error) {
+	return nil, nil
+}
+func (s *blockingService) ValidateOrder(*models.Order) error { return nil }
+func (s *blockingService) ChangeOrderStatus(context.Context, string, models.StatusUpdate) (*models.Order, error) {
+	return nil, nil
+}
+
+func newTestConsumer(r reader, s service) *Consumer {
+	c := &Consumer{
+		reader:    r,
+		admin:     &kafka.Client{},
+		s:         s,
+		log:       logger,
+		backoff:   backoff{maxAttempts: 1},
+		batchSize: 1,
+		sem:       make(chan struct{}, 1),
+		workers:   make(map[int]*partitionWorker),
+		stopped:   make(chan struct{}),
+	}
+	c.fetchCtx, c.stopFetch = context.WithCancel(context.Background())
+	c.procCtx, c.abort = context.WithCancel(context.Background())
+	return c
+}
+
+func TestShutdown_DrainsInFlight(t *testing.T) {
+	t.Parallel()
+
+	m := kafka.Message{Topic: "orders", Partition: 0, Offset: 5, Value: []byte(`{"order_uid":"a"}`)}
+	r := &fakeReader{pending: []kafka.Message{m}}
+	s := newBlockingService()
+	c := newTestConsumer(r, s)
+
+	go c.Start(context.Background())
+	<-s.started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- c.Shutdown(context.Background()) }()
+
+	// пока сохранение не завершено, потребитель не остановлен
+	select {
+	case <-c.stopped:
+		t.Fatal("consumer stopped before in-flight message was processed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(s.release)
+	require.NoError(t, <-shutdown)
+	assert.NoError(t, <-s.result)
+
+	commits := r.commits()
+	require.Len(t, commits, 1)
+	assert.Equal(t, m.Offset, commits[0].Offset)
+}
+
+func TestShutdown_AbortsOnTimeout(t *testing.T) {
+	t.Parallel()
+
+	m := kafka.Message{Topic: "orders", Partition: 0, Offset: 5, Value: []byte(`{"order_uid":"a"}`)}
+	r := &fakeReader{pending: []kafka.Message{m}}
+	s := newBlockingService()
+	c := newTestConsumer(r, s)
+
+	go c.Start(context.Background())
+	<-s.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.NoError(t, c.Shutdown(ctx))
+
+	// Shutdown вернулся только после остановки потребителя, а обработка была прервана
+	select {
+	case <-c.stopped:
+	default:
+		t.Fatal("consumer is not stopped after shutdown")
+	}
+	assert.ErrorIs(t, <-s.result, context.Canceled)
+	assert.Empty(t, r.commits())
+}
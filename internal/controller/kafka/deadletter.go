@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"order-manager/internal/metrics"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	errorClassUnmarshal  = "unmarshal"
+	errorClassValidation = "validation"
+	errorClassInternal   = "internal"
+	errorClassConflict   = "conflict"
+	errorClassNotFound   = "not_found"
+	errorClassTransition = "transition"
+	errorClassVersion    = "version_conflict"
+)
+
+type writer interface {
+	WriteMessages(context.Context, ...kafka.Message) error
+	Close() error
+}
+
+const (
+	headerOriginalTopic     = "x-original-topic"
+	headerOriginalPartition = "x-original-partition"
+	headerOriginalOffset    = "x-original-offset"
+	headerErrorClass        = "x-error-class"
+	headerError             = "x-error"
+)
+
+// sendToDeadLetter перекладывает отклоненное сообщение в dead-letter топик.
+// Ошибка возвращается, если исходный offset коммитить нельзя: публикация не удалась
+// или топик не настроен, а сообщение не сохранено из-за внутренней ошибки.
+func (c *Consumer) sendToDeadLetter(ctx context.Context, m kafka.Message, class string, cause error) error {
+	metrics.KafkaFailed.WithLabelValues(m.Topic, class).Inc()
+
+	if c.deadLetter == nil {
+		// без dead-letter топика валидный заказ, не сохраненный из-за сбоя БД, потерялся бы:
+		// оставляем его незакоммиченным, чтобы перечитать после перезапуска
+		if class == errorClassInternal {
+			c.log.Error("Dead letter topic is not configured, leaving message uncommitted",
+				slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)))
+			return cause
+		}
+		c.log.Warn("Dead letter topic is not configured, dropping message",
+			slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)), slog.String("Class", class))
+		return nil
+	}
+
+	headers := make([]kafka.Header, 0, len(m.Headers)+5)
+	headers = append(headers, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: headerOriginalTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: headerOriginalPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: headerOriginalOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: headerErrorClass, Value: []byte(class)},
+		kafka.Header{Key: headerError, Value: []byte(cause.Error())},
+	)
+
+	err := c.deadLetter.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		c.log.Error("Failed to publish to dead letter topic", slog.String("Error", err.Error()),
+			slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)))
+		return err
+	}
+
+	c.log.Info("Message sent to dead letter topic",
+		slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)), slog.String("Class", class))
+	return nil
+}
@@ -0,0 +1,84 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWriter struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func TestSendToDeadLetter_Headers(t *testing.T) {
+	t.Parallel()
+
+	w := &fakeWriter{}
+	c := &Consumer{log: logger, deadLetter: w}
+	m := kafka.Message{
+		Topic: "orders", Partition: 3, Offset: 17,
+		Key: []byte("b563feb7b2b84b6test"), Value: []byte(`{"order_uid":`),
+		Headers: []kafka.Header{{Key: "traceparent", Value: []byte("00-0102-0304-01")}},
+	}
+
+	require.NoError(t, c.sendToDeadLetter(context.Background(), m, errorClassUnmarshal, errors.New("unexpected end of JSON input")))
+	require.Len(t, w.messages, 1)
+
+	dl := w.messages[0]
+	assert.Equal(t, m.Key, dl.Key)
+	assert.Equal(t, m.Value, dl.Value)
+	assert.Equal(t, []kafka.Header{
+		{Key: "traceparent", Value: []byte("00-0102-0304-01")},
+		{Key: headerOriginalTopic, Value: []byte("orders")},
+		{Key: headerOriginalPartition, Value: []byte("3")},
+		{Key: headerOriginalOffset, Value: []byte("17")},
+		{Key: headerErrorClass, Value: []byte(errorClassUnmarshal)},
+		{Key: headerError, Value: []byte("unexpected end of JSON input")},
+	}, dl.Headers)
+}
+
+func TestSendToDeadLetter_Commit(t *testing.T) {
+	t.Parallel()
+
+	m := kafka.Message{Topic: "orders", Partition: 0, Offset: 1}
+	cases := []struct {
+		name       string
+		deadLetter writer
+		class      string
+		commit     bool
+	}{
+		{name: "published", deadLetter: &fakeWriter{}, class: errorClassInternal, commit: true},
+		{name: "publish failed", deadLetter: &fakeWriter{err: assert.AnError}, class: errorClassValidation, commit: false},
+		{name: "not configured, rejected", class: errorClassValidation, commit: true},
+		{name: "not configured, internal", class: errorClassInternal, commit: false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := &Consumer{log: logger, deadLetter: tc.deadLetter}
+			err := c.sendToDeadLetter(context.Background(), m, tc.class, errors.New("cause"))
+			if tc.commit {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
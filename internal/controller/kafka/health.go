@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// PingBrokers проверяет, что доступен хотя бы один брокер
+func (c *Consumer) PingBrokers(ctx context.Context) error {
+	var errs []error
+	for _, broker := range c.brokers {
+		conn, err := c.dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		conn.Close()
+		return nil
+	}
+	return fmt.Errorf("no kafka broker reachable: %w", errors.Join(errs...))
+}
+
+// CheckGroupMembership проверяет, что консьюмер состоит в своей группе
+func (c *Consumer) CheckGroupMembership(ctx context.Context) error {
+	if c.groupID == "" {
+		return nil
+	}
+
+	resp, err := c.admin.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{c.groupID}})
+	if err != nil {
+		return err
+	}
+
+	for _, group := range resp.Groups {
+		if group.Error != nil {
+			return group.Error
+		}
+		for _, member := range group.Members {
+			if member.ClientID == c.dialer.ClientID {
+				return nil
+			}
+		}
+		return fmt.Errorf("consumer is not a member of group %q (state %s)", c.groupID, group.GroupState)
+	}
+	return fmt.Errorf("consumer group %q not found", c.groupID)
+}
@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"order-manager/internal/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	partitionQueueSize = 64
+	// minPartitionPause - нижняя граница паузы партиции, если backoff не настроен
+	minPartitionPause = 100 * time.Millisecond
+)
+
+// offsetTracker хранит offset'ы партиции в порядке получения и отдает
+// последний offset, до которого все сообщения обработаны без пропусков
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64
+	done    map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{done: make(map[int64]bool)}
+}
+
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// offset меньше уже полученного значит, что партицию перечитывают с последнего коммита
+	// (ребаланс, повторная доставка) - старые пропуски больше не актуальны
+	if n := len(t.pending); n > 0 && offset <= t.pending[n-1] {
+		t.pending = t.pending[:0]
+		clear(t.done)
+	}
+	t.pending = append(t.pending, offset)
+}
+
+// markDone отмечает offset обработанным и возвращает новую границу коммита
+// и сколько сообщений она покрыла; 0 означает, что граница не сдвинулась
+func (t *offsetTracker) markDone(offset int64) (int64, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+
+	committed, advanced := int64(0), 0
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		committed = t.pending[0]
+		advanced++
+		delete(t.done, t.pending[0])
+		t.pending = t.pending[1:]
+	}
+	return committed, advanced
+}
+
+// inbound - сообщение вместе с контекстом трассировки продюсера из его заголовков
+type inbound struct {
+	kafka.Message
+	spanCtx trace.SpanContext
+}
+
+type partitionWorker struct {
+	topic     string
+	partition int
+	messages  chan inbound
+	tracker   *offsetTracker
+}
+
+func (c *Consumer) dispatch(ctx context.Context, m inbound) {
+	w, found := c.workers[m.Partition]
+	if !found {
+		w = &partitionWorker{
+			topic:     m.Topic,
+			partition: m.Partition,
+			messages:  make(chan inbound, partitionQueueSize),
+			tracker:   newOffsetTracker(),
+		}
+		c.workers[m.Partition] = w
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.runWorker(c.procCtx, w)
+		}()
+		c.log.Info("Started partition worker", slog.Int("Partition", m.Partition))
+	}
+
+	w.tracker.add(m.Offset)
+	select {
+	case w.messages <- m:
+	case <-ctx.Done():
+	}
+}
+
+func (c *Consumer) runWorker(ctx context.Context, w *partitionWorker) {
+	for {
+		batch, open := c.collectBatch(ctx, w.messages)
+		if len(batch) > 0 {
+			c.processBatch(ctx, w, batch)
+		}
+		if !open || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// processBatch обрабатывает пачку и коммитит обработанные сообщения. Если сообщение
+// коммитить нельзя (БД недоступна, а dead-letter не настроен или не отвечает), партиция
+// встает на паузу и повторяет его, не переходя к следующим: иначе граница коммита
+// застряла бы, а после перезапуска сообщение применилось бы поверх более новых.
+func (c *Consumer) processBatch(ctx context.Context, w *partitionWorker, batch []inbound) {
+	for attempt := 0; len(batch) > 0; attempt++ {
+		if attempt > 0 {
+			wait := max(c.backoff.delay(attempt-1), minPartitionPause)
+			c.log.Warn("Partition paused on uncommitted message", slog.Int("Partition", w.partition),
+				slog.Int("Offset", int(batch[0].Offset)), slog.Int("Attempt", attempt), slog.Duration("Backoff", wait))
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		done, pending := c.handleBatch(ctx, batch)
+		<-c.sem
+
+		c.commitDone(ctx, w, done)
+		batch = pending
+	}
+}
+
+// commitDone отмечает сообщения обработанными и коммитит новую границу партиции
+func (c *Consumer) commitDone(ctx context.Context, w *partitionWorker, done []kafka.Message) {
+	var (
+		offset   int64
+		advanced int
+	)
+	for _, m := range done {
+		if o, n := w.tracker.markDone(m.Offset); n > 0 {
+			offset = o
+			advanced += n
+		}
+	}
+	if advanced > 0 && c.commit(ctx, kafka.Message{Topic: w.topic, Partition: w.partition, Offset: offset}) {
+		metrics.KafkaCommitted.WithLabelValues(w.topic, strconv.Itoa(w.partition)).Add(float64(advanced))
+	}
+}
+
+func (c *Consumer) stopWorkers() {
+	for partition, w := range c.workers {
+		close(w.messages)
+		delete(c.workers, partition)
+	}
+	c.wg.Wait()
+}
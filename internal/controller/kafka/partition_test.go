@@ -0,0 +1,46 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetTracker_CommitsOnlyContiguous(t *testing.T) {
+	t.Parallel()
+
+	tr := newOffsetTracker()
+	for _, offset := range []int64{10, 11, 12, 13} {
+		tr.add(offset)
+	}
+
+	offset, n := tr.markDone(10)
+	assert.Equal(t, 1, n)
+	assert.EqualValues(t, 10, offset)
+
+	// 11 не обработан - коммит не должен перескочить через него
+	_, n = tr.markDone(12)
+	assert.Zero(t, n)
+	_, n = tr.markDone(13)
+	assert.Zero(t, n)
+
+	offset, n = tr.markDone(11)
+	assert.Equal(t, 3, n)
+	assert.EqualValues(t, 13, offset)
+}
+
+func TestOffsetTracker_ResetsOnRewind(t *testing.T) {
+	t.Parallel()
+
+	tr := newOffsetTracker()
+	tr.add(5)
+	tr.add(6)
+	_, n := tr.markDone(6)
+	assert.Zero(t, n)
+
+	// партицию перечитывают с 5 после ребаланса
+	tr.add(5)
+	offset, n := tr.markDone(5)
+	assert.Equal(t, 1, n)
+	assert.EqualValues(t, 5, offset)
+}
@@ -0,0 +1,80 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"order-manager/internal/config"
+	"order-manager/internal/metrics"
+	"time"
+)
+
+type backoff struct {
+	initial     time.Duration
+	max         time.Duration
+	maxElapsed  time.Duration
+	maxAttempts int
+}
+
+func newBackoff(cfg config.Kafka) backoff {
+	return backoff{
+		initial:     cfg.RetryInitialInterval,
+		max:         cfg.RetryMaxInterval,
+		maxElapsed:  cfg.RetryMaxElapsed,
+		maxAttempts: cfg.RetryMaxAttempts,
+	}
+}
+
+// delay возвращает паузу перед повтором номер attempt (с нуля): full jitter
+// в пределах initial*2^attempt, но не больше max
+func (b backoff) delay(attempt int) time.Duration {
+	ceiling := b.max
+	if attempt < 32 {
+		if d := b.initial << attempt; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+// retry выполняет op, пока isTransient считает ошибку временной, а попытки и время не исчерпаны.
+// Возвращает последнюю ошибку op или ошибку контекста.
+func (c *Consumer) retry(ctx context.Context, attrs []any, isTransient func(error) bool, op func() error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !isTransient(err) {
+			return err
+		}
+
+		if attempt >= c.backoff.maxAttempts {
+			metrics.KafkaGiveUps.Inc()
+			c.log.Error("Giving up after retries", append(attrs,
+				slog.Int("Attempts", attempt), slog.String("Reason", "max attempts"), slog.String("Error", err.Error()))...)
+			return err
+		}
+
+		wait := c.backoff.delay(attempt - 1)
+		if c.backoff.maxElapsed > 0 && time.Since(start)+wait > c.backoff.maxElapsed {
+			metrics.KafkaGiveUps.Inc()
+			c.log.Error("Giving up after retries", append(attrs,
+				slog.Int("Attempts", attempt), slog.String("Reason", "max elapsed time"), slog.String("Error", err.Error()))...)
+			return err
+		}
+
+		metrics.KafkaRetries.Inc()
+		c.log.Warn("Retrying after transient error", append(attrs,
+			slog.Int("Attempt", attempt), slog.Duration("Backoff", wait), slog.String("Error", err.Error()))...)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"order-manager/internal/metrics"
+	"order-manager/pkg/errorx"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+func TestBackoffDelay_Capped(t *testing.T) {
+	t.Parallel()
+
+	b := backoff{initial: 10 * time.Millisecond, max: 50 * time.Millisecond}
+
+	for attempt := 0; attempt < 100; attempt++ {
+		d := b.delay(attempt)
+		assert.Positive(t, d)
+		assert.LessOrEqual(t, d, 50*time.Millisecond)
+	}
+	assert.LessOrEqual(t, b.delay(0), 10*time.Millisecond)
+}
+
+// тесты со счетчиками метрик не параллельны: счетчики общие для пакета
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	c := &Consumer{log: logger, backoff: backoff{initial: time.Millisecond, max: time.Millisecond, maxAttempts: 3}}
+	retries, giveUps := testutil.ToFloat64(metrics.KafkaRetries), testutil.ToFloat64(metrics.KafkaGiveUps)
+
+	calls := 0
+	err := c.retry(context.Background(), nil, isTransient, func() error {
+		calls++
+		return fmt.Errorf("save: %w", errorx.ErrInternal)
+	})
+
+	require.ErrorIs(t, err, errorx.ErrInternal)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, retries+2, testutil.ToFloat64(metrics.KafkaRetries))
+	assert.Equal(t, giveUps+1, testutil.ToFloat64(metrics.KafkaGiveUps))
+}
+
+func TestRetry_NotTransient(t *testing.T) {
+	c := &Consumer{log: logger, backoff: backoff{initial: time.Millisecond, max: time.Millisecond, maxAttempts: 3}}
+	retries, giveUps := testutil.ToFloat64(metrics.KafkaRetries), testutil.ToFloat64(metrics.KafkaGiveUps)
+
+	calls := 0
+	err := c.retry(context.Background(), nil, isTransient, func() error {
+		calls++
+		return errorx.ErrOrderValidation
+	})
+
+	require.ErrorIs(t, err, errorx.ErrOrderValidation)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, retries, testutil.ToFloat64(metrics.KafkaRetries))
+	assert.Equal(t, giveUps, testutil.ToFloat64(metrics.KafkaGiveUps))
+}
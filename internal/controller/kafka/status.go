@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"order-manager/internal/models"
+	"order-manager/pkg/errorx"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// headerMessageType отличает смену статуса от полного заказа;
+	// сообщения без заголовка считаются заказами
+	headerMessageType = "message-type"
+	messageTypeOrder  = "order"
+	messageTypeStatus = "order.status"
+)
+
+func messageType(m kafka.Message) string {
+	for _, h := range m.Headers {
+		if h.Key == headerMessageType {
+			return string(h.Value)
+		}
+	}
+	return messageTypeOrder
+}
+
+// handleStatusUpdate применяет смену статуса заказа. Возвращает ошибку, если сообщение нельзя коммитить.
+func (c *Consumer) handleStatusUpdate(ctx context.Context, m kafka.Message) error {
+	var update models.StatusUpdate
+	if err := json.Unmarshal(m.Value, &update); err != nil {
+		c.log.Error("Failed to unmarshal status update", slog.String("Error", err.Error()))
+		return c.sendToDeadLetter(ctx, m, errorClassUnmarshal, err)
+	}
+	if update.OrderUID == "" {
+		return c.sendToDeadLetter(ctx, m, errorClassValidation, errors.New("order_uid is required"))
+	}
+	src, err := messageSource(m)
+	if err != nil {
+		return c.sendToDeadLetter(ctx, m, errorClassValidation, err)
+	}
+	if update.Source == "" {
+		update.Source = models.SourceKafka
+	}
+
+	attrs := []any{slog.Int("Partition", m.Partition), slog.Int("Offset", int(m.Offset)), slog.String("order_uid", update.OrderUID)}
+	changeCtx := models.WithChangeSource(ctx, src)
+	err = c.retry(ctx, attrs, isTransient, func() error {
+		_, err := c.s.ChangeOrderStatus(changeCtx, update.OrderUID, update)
+		return err
+	})
+	if err != nil {
+		c.log.Warn("Not changed order status", slog.String("Error", err.Error()))
+		switch {
+		case errors.Is(err, errorx.ErrOrderValidation):
+			return c.sendToDeadLetter(ctx, m, errorClassValidation, err)
+		case errors.Is(err, errorx.ErrOrderNotFound):
+			return c.sendToDeadLetter(ctx, m, errorClassNotFound, err)
+		case errors.Is(err, errorx.ErrStatusTransition):
+			return c.sendToDeadLetter(ctx, m, errorClassTransition, err)
+		case errors.Is(err, errorx.ErrVersionConflict):
+			return c.sendToDeadLetter(ctx, m, errorClassVersion, err)
+		case isTransient(err):
+			return c.sendToDeadLetter(ctx, m, errorClassInternal, err)
+		}
+		return err
+	}
+
+	return nil
+}
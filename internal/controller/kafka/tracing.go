@@ -0,0 +1,38 @@
+package kafka
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("order-manager/internal/controller/kafka")
+
+// startProcessSpan начинает спан обработки пачки. Одиночное сообщение продолжает
+// трассу продюсера, а пачка ссылается на трассы всех своих сообщений.
+func startProcessSpan(ctx context.Context, messages []inbound) (context.Context, trace.Span) {
+	first := messages[0]
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination.name", first.Topic),
+			attribute.Int("messaging.destination.partition.id", first.Partition),
+			attribute.Int("messaging.batch.message_count", len(messages)),
+		),
+	}
+
+	if len(messages) == 1 {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, first.spanCtx)
+	} else {
+		for _, m := range messages {
+			if m.spanCtx.IsValid() {
+				opts = append(opts, trace.WithLinks(trace.Link{SpanContext: m.spanCtx}))
+			}
+		}
+	}
+
+	return tracer.Start(ctx, first.Topic+" process", opts...)
+}
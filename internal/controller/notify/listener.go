@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"order-manager/internal/models"
+	"order-manager/pkg/db"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+type service interface {
+	InvalidateOrder(context.Context, string)
+	RefreshOrder(context.Context, string)
+	ReconcileCache(context.Context) (int, error)
+}
+
+// Listener слушает уведомления об изменении заказов от других реплик
+// и поддерживает локальный кэш в согласованном состоянии
+type Listener struct {
+	pool       *pgxpool.Pool
+	s          service
+	log        *slog.Logger
+	instanceID string
+	refresh    bool
+
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+func NewListener(pool *pgxpool.Pool, s service, log *slog.Logger, instanceID string, refresh bool) *Listener {
+	return &Listener{
+		pool:       pool,
+		s:          s,
+		log:        log,
+		instanceID: instanceID,
+		refresh:    refresh,
+		ready:      make(chan struct{}),
+	}
+}
+
+// Ready закрывается после первого успешного LISTEN: изменения, сделанные после этого,
+// не пройдут мимо кэша
+func (l *Listener) Ready() <-chan struct{} {
+	return l.ready
+}
+
+func (l *Listener) Start(ctx context.Context) {
+	l.log.Info("Starting order notification listener", slog.String("channel", db.OrderChangedChannel))
+
+	delay := minReconnectDelay
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		l.log.Error("Notification listener disconnected", slog.String("error", err.Error()), slog.Duration("retry_in", delay))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func (l *Listener) listen(ctx context.Context) error {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// соединение с LISTEN нельзя возвращать в пул
+	pgConn := conn.Hijack()
+	defer pgConn.Close(context.Background())
+
+	if _, err = pgConn.Exec(ctx, "LISTEN "+db.OrderChangedChannel); err != nil {
+		return err
+	}
+	l.readyOnce.Do(func() { close(l.ready) })
+
+	// уведомления, отправленные пока соединения не было, не повторяются - сверяем кэш с БД
+	if _, err = l.s.ReconcileCache(ctx); err != nil {
+		return err
+	}
+
+	for {
+		n, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var msg models.OrderNotification
+		if err = json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			l.log.Warn("Invalid order notification", slog.String("payload", n.Payload))
+			continue
+		}
+		if msg.Instance == l.instanceID {
+			continue
+		}
+
+		if l.refresh {
+			l.s.RefreshOrder(ctx, msg.OrderUID)
+		} else {
+			l.s.InvalidateOrder(ctx, msg.OrderUID)
+		}
+	}
+}
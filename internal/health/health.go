@@ -0,0 +1,94 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check проверяет одну зависимость; nil означает, что она доступна
+type Check func(ctx context.Context) error
+
+type Component struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker выполняет проверки зависимостей параллельно, каждую со своим таймаутом
+type Checker struct {
+	checks  []namedCheck
+	timeout time.Duration
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+func (c *Checker) Register(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{
+		Status:     StatusUp,
+		Components: make(map[string]Component, len(c.checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			component := c.run(ctx, nc.check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[nc.name] = component
+			if component.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Component {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := check(ctx)
+	component := Component{
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		component.Status = StatusDown
+		component.Error = err.Error()
+	}
+	return component
+}
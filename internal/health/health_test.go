@@ -0,0 +1,41 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"order-manager/internal/health"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_ReportsFailedComponent(t *testing.T) {
+	t.Parallel()
+
+	checker := health.NewChecker(time.Second)
+	checker.Register("db", func(context.Context) error { return nil })
+	checker.Register("kafka", func(context.Context) error { return errors.New("unreachable") })
+
+	report := checker.Check(context.Background())
+
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, health.StatusUp, report.Components["db"].Status)
+	assert.Equal(t, health.StatusDown, report.Components["kafka"].Status)
+	assert.Equal(t, "unreachable", report.Components["kafka"].Error)
+}
+
+func TestChecker_TimesOutSlowCheck(t *testing.T) {
+	t.Parallel()
+
+	checker := health.NewChecker(10 * time.Millisecond)
+	checker.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := checker.Check(context.Background())
+
+	assert.Equal(t, health.StatusDown, report.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Components["slow"].Error)
+}
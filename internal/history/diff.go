@@ -0,0 +1,163 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"order-manager/internal/models"
+	"reflect"
+	"sort"
+)
+
+// arrayKeys - поля-массивы, элементы которых сравниваются по ключу, а не по индексу:
+// удаление товара из середины списка не должно выглядеть как изменение всех следующих
+var arrayKeys = map[string]string{
+	"items":    "rid",
+	"payments": "transaction",
+}
+
+// Diff сравнивает два JSON-снимка заказа и возвращает изменения по полям
+// в порядке обхода: поля объектов по алфавиту, элементы массивов по порядку.
+func Diff(from, to []byte) ([]models.FieldChange, error) {
+	a, err := decode(from)
+	if err != nil {
+		return nil, fmt.Errorf("decode from: %w", err)
+	}
+	b, err := decode(to)
+	if err != nil {
+		return nil, fmt.Errorf("decode to: %w", err)
+	}
+
+	changes := []models.FieldChange{}
+	walk("", a, b, &changes)
+	return changes, nil
+}
+
+// decode сохраняет числа как json.Number, чтобы сравнивать и отдавать их без потери точности
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func walk(path string, a, b any, changes *[]models.FieldChange) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		walkObject(path, av, bv, changes)
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		if key, ok := arrayKeys[path]; ok && keyed(av, key) && keyed(bv, key) {
+			walkKeyed(path, key, av, bv, changes)
+		} else {
+			walkIndexed(path, av, bv, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		*changes = append(*changes, models.FieldChange{Path: path, Op: models.DiffChanged, Old: a, New: b})
+	}
+}
+
+func walkObject(path string, a, b map[string]any, changes *[]models.FieldChange) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := k
+		if path != "" {
+			child = path + "." + k
+		}
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inB:
+			*changes = append(*changes, models.FieldChange{Path: child, Op: models.DiffRemoved, Old: va})
+		case !inA:
+			*changes = append(*changes, models.FieldChange{Path: child, Op: models.DiffAdded, New: vb})
+		default:
+			walk(child, va, vb, changes)
+		}
+	}
+}
+
+func walkIndexed(path string, a, b []any, changes *[]models.FieldChange) {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		child := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(b):
+			*changes = append(*changes, models.FieldChange{Path: child, Op: models.DiffRemoved, Old: a[i]})
+		case i >= len(a):
+			*changes = append(*changes, models.FieldChange{Path: child, Op: models.DiffAdded, New: b[i]})
+		default:
+			walk(child, a[i], b[i], changes)
+		}
+	}
+}
+
+func walkKeyed(path, key string, a, b []any, changes *[]models.FieldChange) {
+	byKey := make(map[string]any, len(b))
+	for _, el := range b {
+		byKey[keyOf(el, key)] = el
+	}
+
+	seen := make(map[string]struct{}, len(a))
+	for _, el := range a {
+		k := keyOf(el, key)
+		seen[k] = struct{}{}
+		child := fmt.Sprintf("%s[%s=%s]", path, key, k)
+		if other, ok := byKey[k]; ok {
+			walk(child, el, other, changes)
+		} else {
+			*changes = append(*changes, models.FieldChange{Path: child, Op: models.DiffRemoved, Old: el})
+		}
+	}
+	for _, el := range b {
+		k := keyOf(el, key)
+		if _, ok := seen[k]; !ok {
+			*changes = append(*changes, models.FieldChange{Path: fmt.Sprintf("%s[%s=%s]", path, key, k), Op: models.DiffAdded, New: el})
+		}
+	}
+}
+
+// keyed проверяет, что у каждого элемента есть уникальный ключ; иначе массив сравнивается по индексам
+func keyed(elems []any, key string) bool {
+	seen := make(map[string]struct{}, len(elems))
+	for _, el := range elems {
+		obj, ok := el.(map[string]any)
+		if !ok {
+			return false
+		}
+		if _, ok = obj[key]; !ok {
+			return false
+		}
+		k := keyOf(el, key)
+		if _, dup := seen[k]; dup {
+			return false
+		}
+		seen[k] = struct{}{}
+	}
+	return true
+}
+
+func keyOf(el any, key string) string {
+	return fmt.Sprint(el.(map[string]any)[key])
+}
@@ -0,0 +1,77 @@
+package history_test
+
+import (
+	"encoding/json"
+	"order-manager/internal/history"
+	"order-manager/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff_NestedFields(t *testing.T) {
+	t.Parallel()
+
+	from := `{"track_number": "A", "delivery": {"city": "Moscow", "zip": "1"}, "internal_signature": ""}`
+	to := `{"track_number": "A", "delivery": {"city": "Kazan", "zip": "1"}, "status": "paid"}`
+
+	changes, err := history.Diff([]byte(from), []byte(to))
+	require.NoError(t, err)
+	assert.Equal(t, []models.FieldChange{
+		{Path: "delivery.city", Op: models.DiffChanged, Old: "Moscow", New: "Kazan"},
+		{Path: "internal_signature", Op: models.DiffRemoved, Old: ""},
+		{Path: "status", Op: models.DiffAdded, New: "paid"},
+	}, changes)
+}
+
+func TestDiff_ItemsMatchedByRid(t *testing.T) {
+	t.Parallel()
+
+	from := `{"items": [{"rid": "a", "price": 100}, {"rid": "b", "price": 200}, {"rid": "c", "price": 300}]}`
+	to := `{"items": [{"rid": "a", "price": 100}, {"rid": "c", "price": 350}, {"rid": "d", "price": 400}]}`
+
+	changes, err := history.Diff([]byte(from), []byte(to))
+	require.NoError(t, err)
+	require.Len(t, changes, 3)
+
+	assert.Equal(t, "items[rid=b]", changes[0].Path)
+	assert.Equal(t, models.DiffRemoved, changes[0].Op)
+	assert.Equal(t, models.FieldChange{Path: "items[rid=c].price", Op: models.DiffChanged, Old: json.Number("300"), New: json.Number("350")}, changes[1])
+	assert.Equal(t, "items[rid=d]", changes[2].Path)
+	assert.Equal(t, models.DiffAdded, changes[2].Op)
+}
+
+func TestDiff_UnkeyedArraysByIndex(t *testing.T) {
+	t.Parallel()
+
+	from := `{"warnings": [{"code": "X"}]}`
+	to := `{"warnings": [{"code": "Y"}, {"code": "Z"}]}`
+
+	changes, err := history.Diff([]byte(from), []byte(to))
+	require.NoError(t, err)
+	assert.Equal(t, []models.FieldChange{
+		{Path: "warnings[0].code", Op: models.DiffChanged, Old: "X", New: "Y"},
+		{Path: "warnings[1]", Op: models.DiffAdded, New: map[string]any{"code": "Z"}},
+	}, changes)
+}
+
+func TestDiff_FromEmpty(t *testing.T) {
+	t.Parallel()
+
+	changes, err := history.Diff([]byte(`{}`), []byte(`{"order_uid": "u1", "sm_id": 99}`))
+	require.NoError(t, err)
+	assert.Equal(t, []models.FieldChange{
+		{Path: "order_uid", Op: models.DiffAdded, New: "u1"},
+		{Path: "sm_id", Op: models.DiffAdded, New: json.Number("99")},
+	}, changes)
+}
+
+func TestDiff_Equal(t *testing.T) {
+	t.Parallel()
+
+	snapshot := []byte(`{"payments": [{"transaction": "t1", "amount": 10}], "items": []}`)
+	changes, err := history.Diff(snapshot, snapshot)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
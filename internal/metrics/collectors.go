@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"order-manager/internal/cache"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type cacheStats interface {
+	Stats() cache.Stats
+}
+
+// CacheCollector снимает статистику кэша в момент запроса /metrics
+type CacheCollector struct {
+	c cacheStats
+
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	entries   *prometheus.Desc
+	notFound  *prometheus.Desc
+	bytes     *prometheus.Desc
+}
+
+func NewCacheCollector(c cacheStats) *CacheCollector {
+	return &CacheCollector{
+		c:         c,
+		hits:      prometheus.NewDesc(namespace+"_cache_hits_total", "Cache hits.", nil, nil),
+		misses:    prometheus.NewDesc(namespace+"_cache_misses_total", "Cache misses.", nil, nil),
+		evictions: prometheus.NewDesc(namespace+"_cache_evictions_total", "Cache evictions by reason.", []string{"reason"}, nil),
+		entries:   prometheus.NewDesc(namespace+"_cache_entries", "Orders in cache.", nil, nil),
+		notFound:  prometheus.NewDesc(namespace+"_cache_not_found_entries", "Negative cache entries.", nil, nil),
+		bytes:     prometheus.NewDesc(namespace+"_cache_bytes", "Approximate cache size in bytes.", nil, nil),
+	}
+}
+
+func (cc *CacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.hits
+	ch <- cc.misses
+	ch <- cc.evictions
+	ch <- cc.entries
+	ch <- cc.notFound
+	ch <- cc.bytes
+}
+
+func (cc *CacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := cc.c.Stats()
+
+	ch <- prometheus.MustNewConstMetric(cc.hits, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(cc.misses, prometheus.CounterValue, float64(stats.Misses))
+	for reason, count := range stats.Evictions {
+		ch <- prometheus.MustNewConstMetric(cc.evictions, prometheus.CounterValue, float64(count), reason)
+	}
+	ch <- prometheus.MustNewConstMetric(cc.entries, prometheus.GaugeValue, float64(stats.Entries))
+	ch <- prometheus.MustNewConstMetric(cc.notFound, prometheus.GaugeValue, float64(stats.NotFound))
+	ch <- prometheus.MustNewConstMetric(cc.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+}
+
+// PoolCollector снимает статистику пула соединений pgx
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired     *prometheus.Desc
+	idle         *prometheus.Desc
+	total        *prometheus.Desc
+	max          *prometheus.Desc
+	acquireCount *prometheus.Desc
+	emptyAcquire *prometheus.Desc
+	acquireWait  *prometheus.Desc
+}
+
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	return &PoolCollector{
+		pool:         pool,
+		acquired:     prometheus.NewDesc(namespace+"_db_pool_acquired_conns", "Connections currently acquired.", nil, nil),
+		idle:         prometheus.NewDesc(namespace+"_db_pool_idle_conns", "Idle connections.", nil, nil),
+		total:        prometheus.NewDesc(namespace+"_db_pool_total_conns", "Total connections in the pool.", nil, nil),
+		max:          prometheus.NewDesc(namespace+"_db_pool_max_conns", "Maximum pool size.", nil, nil),
+		acquireCount: prometheus.NewDesc(namespace+"_db_pool_acquires_total", "Successful connection acquires.", nil, nil),
+		emptyAcquire: prometheus.NewDesc(namespace+"_db_pool_empty_acquires_total", "Acquires that had to wait for a connection.", nil, nil),
+		acquireWait:  prometheus.NewDesc(namespace+"_db_pool_acquire_wait_seconds_total", "Total time spent waiting for a connection.", nil, nil),
+	}
+}
+
+func (pc *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.acquired
+	ch <- pc.idle
+	ch <- pc.total
+	ch <- pc.max
+	ch <- pc.acquireCount
+	ch <- pc.emptyAcquire
+	ch <- pc.acquireWait
+}
+
+func (pc *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := pc.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(pc.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(pc.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(pc.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(pc.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(pc.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.emptyAcquire, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(pc.acquireWait, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+}
@@ -0,0 +1,46 @@
+package metrics_test
+
+import (
+	"context"
+	"order-manager/internal/cache"
+	"order-manager/internal/config"
+	"order-manager/internal/metrics"
+	"order-manager/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheCollector(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	c := cache.NewCache(config.Cache{Size: 1, Policy: cache.PolicyLRU})
+	c.SetOrder(ctx, models.Order{OrderUID: "a"})
+	c.SetOrder(ctx, models.Order{OrderUID: "b"})
+	c.GetOrder(ctx, "b")
+	c.GetOrder(ctx, "a")
+
+	expected := `
+# HELP order_manager_cache_entries Orders in cache.
+# TYPE order_manager_cache_entries gauge
+order_manager_cache_entries 1
+# HELP order_manager_cache_evictions_total Cache evictions by reason.
+# TYPE order_manager_cache_evictions_total counter
+order_manager_cache_evictions_total{reason="capacity"} 1
+# HELP order_manager_cache_hits_total Cache hits.
+# TYPE order_manager_cache_hits_total counter
+order_manager_cache_hits_total 1
+# HELP order_manager_cache_misses_total Cache misses.
+# TYPE order_manager_cache_misses_total counter
+order_manager_cache_misses_total 1
+`
+	err := testutil.CollectAndCompare(metrics.NewCacheCollector(c), strings.NewReader(expected),
+		"order_manager_cache_entries", "order_manager_cache_evictions_total",
+		"order_manager_cache_hits_total", "order_manager_cache_misses_total")
+	require.NoError(t, err)
+	assert.Equal(t, 6, testutil.CollectAndCount(metrics.NewCacheCollector(c)))
+}
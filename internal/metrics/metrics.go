@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "order_manager"
+
+const (
+	OutcomeSuccess         = "success"
+	OutcomeValidationError = "validation_error"
+	OutcomeInternalError   = "internal_error"
+	OutcomeConflict        = "conflict"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	KafkaConsumed = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_messages_consumed_total",
+		Help:      "Messages fetched from Kafka.",
+	}, []string{"topic", "partition"})
+
+	KafkaFailed = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_messages_failed_total",
+		Help:      "Messages rejected by the consumer, by error class.",
+	}, []string{"topic", "class"})
+
+	KafkaCommitted = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_messages_committed_total",
+		Help:      "Messages whose offsets were committed.",
+	}, []string{"topic", "partition"})
+
+	KafkaRetries = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_retries_total",
+		Help:      "Retries of transient processing errors.",
+	})
+
+	KafkaGiveUps = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kafka_retry_give_ups_total",
+		Help:      "Messages whose transient errors outlasted the retry budget.",
+	})
+
+	KafkaLag = promauto.With(Registry).NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "kafka_consumer_lag",
+		Help:      "Messages behind the partition high water mark at the last fetch.",
+	}, []string{"topic", "partition"})
+
+	OutboxPublished = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_events_published_total",
+		Help:      "Order events published from the outbox.",
+	}, []string{"event_type"})
+
+	SaveDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "order_save_duration_seconds",
+		Help:      "Order save latency by method and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
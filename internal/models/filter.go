@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/base64"
+	"order-manager/pkg/errorx"
+	"strings"
+	"time"
+)
+
+type OrderCursor struct {
+	DateCreated time.Time
+	OrderUID    string
+}
+
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Entry           string
+	Locale          string
+	DateFrom        *time.Time
+	DateTo          *time.Time
+	After           *OrderCursor
+	Limit           int
+}
+
+type OrderList struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// Encode упаковывает позицию последнего заказа страницы в непрозрачный токен
+func (c OrderCursor) Encode() string {
+	raw := c.DateCreated.UTC().Format(time.RFC3339Nano) + "|" + c.OrderUID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(token string) (*OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errorx.ErrInvalidCursor
+	}
+
+	date, uid, found := strings.Cut(string(raw), "|")
+	if !found || uid == "" {
+		return nil, errorx.ErrInvalidCursor
+	}
+
+	dateCreated, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return nil, errorx.ErrInvalidCursor
+	}
+
+	return &OrderCursor{DateCreated: dateCreated, OrderUID: uid}, nil
+}
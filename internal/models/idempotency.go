@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	StatusCode  int
+	Headers     map[string]string
+	Body        []byte
+	CreatedAt   time.Time
+}
@@ -18,6 +18,7 @@ type Delivery struct {
 type Payment struct {
 	OrderUID     string `json:"-"`
 	Transaction  string `json:"transaction" validate:"required"`
+	Type         string `json:"type,omitempty"`
 	RequestID    string `json:"request_id"`
 	Currency     string `json:"currency" validate:"required"`
 	Provider     string `json:"provider" validate:"required"`
@@ -35,6 +36,8 @@ type Order struct {
 	Entry             string    `json:"entry" validate:"required"`
 	Delivery          Delivery  `json:"delivery" validate:"required"`
 	Payment           Payment   `json:"payment" validate:"required"`
+	Payments          []Payment `json:"payments,omitempty" validate:"-"`
+	NetPaid           int       `json:"net_paid" validate:"-"`
 	Item              []Item    `json:"items" validate:"required,min=1"`
 	Locate            string    `json:"locale" validate:"required"`
 	InternalSignature string    `json:"internal_signature"`
@@ -44,6 +47,10 @@ type Order struct {
 	SmID              int       `json:"sm_id" validate:"required"`
 	DateCreated       time.Time `json:"date_created" validate:"required"`
 	OffShard          string    `json:"oof_shard" validate:"required"`
+
+	Status   OrderStatus    `json:"status,omitempty" validate:"-"`
+	Version  int            `json:"version,omitempty" validate:"-"`
+	Warnings []OrderWarning `json:"warnings,omitempty" validate:"-"`
 }
 
 type Item struct {
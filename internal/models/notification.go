@@ -0,0 +1,6 @@
+package models
+
+type OrderNotification struct {
+	OrderUID string `json:"order_uid"`
+	Instance string `json:"instance"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+)
+
+// OutboxEvent - событие заказа, записанное в outbox в одной транзакции с заказом
+type OutboxEvent struct {
+	ID        int64
+	OrderUID  string
+	Type      string
+	Payload   []byte
+	Headers   map[string]string
+	CreatedAt time.Time
+}
+
+// OrderEvent - сообщение о событии заказа для внешних потребителей
+type OrderEvent struct {
+	EventID    int64           `json:"event_id"`
+	Type       string          `json:"event_type"`
+	OrderUID   string          `json:"order_uid"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Order      json.RawMessage `json:"order"`
+}
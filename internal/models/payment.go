@@ -0,0 +1,49 @@
+package models
+
+const (
+	PaymentCharge     = "charge"
+	PaymentCapture    = "capture"
+	PaymentRefund     = "refund"
+	PaymentChargeback = "chargeback"
+)
+
+// PaymentSign возвращает знак транзакции в чистой сумме оплаты:
+// списания увеличивают ее, возвраты уменьшают, неизвестный тип - 0
+func PaymentSign(paymentType string) int {
+	switch paymentType {
+	case PaymentCharge, PaymentCapture:
+		return 1
+	case PaymentRefund, PaymentChargeback:
+		return -1
+	}
+	return 0
+}
+
+// NormalizePayments приводит оплату заказа к одному виду: старые клиенты присылают
+// только payment, новые - список payments. После вызова payments содержит все
+// транзакции, payment - первое списание, net_paid - чистую сумму оплаты.
+func (o *Order) NormalizePayments() {
+	if len(o.Payments) == 0 && o.Payment.Transaction != "" {
+		o.Payments = []Payment{o.Payment}
+	}
+
+	primary := -1
+	o.NetPaid = 0
+	for i := range o.Payments {
+		p := &o.Payments[i]
+		if p.Type == "" {
+			p.Type = PaymentCharge
+		}
+		if primary < 0 && p.Type == PaymentCharge {
+			primary = i
+		}
+		o.NetPaid += PaymentSign(p.Type) * p.Amount
+	}
+
+	if primary < 0 && len(o.Payments) > 0 {
+		primary = 0
+	}
+	if primary >= 0 {
+		o.Payment = o.Payments[primary]
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+type OrderStatus string
+
+const (
+	StatusCreated    OrderStatus = "created"
+	StatusPaid       OrderStatus = "paid"
+	StatusAssembling OrderStatus = "assembling"
+	StatusShipped    OrderStatus = "shipped"
+	StatusDelivered  OrderStatus = "delivered"
+	StatusCancelled  OrderStatus = "cancelled"
+	StatusReturned   OrderStatus = "returned"
+)
+
+// transitions - допустимые переходы жизненного цикла заказа;
+// cancelled и returned конечные
+var transitions = map[OrderStatus][]OrderStatus{
+	StatusCreated:    {StatusPaid, StatusCancelled},
+	StatusPaid:       {StatusAssembling, StatusCancelled},
+	StatusAssembling: {StatusShipped, StatusCancelled},
+	StatusShipped:    {StatusDelivered, StatusReturned},
+	StatusDelivered:  {StatusReturned},
+	StatusCancelled:  {},
+	StatusReturned:   {},
+}
+
+func (s OrderStatus) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusUpdate - запрос на смену статуса заказа из HTTP или Kafka
+type StatusUpdate struct {
+	OrderUID string      `json:"order_uid,omitempty"`
+	Status   OrderStatus `json:"status"`
+	Source   string      `json:"source,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+}
+
+// StatusChange - запись истории переходов статуса заказа
+type StatusChange struct {
+	OrderUID  string      `json:"order_uid"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	Source    string      `json:"source"`
+	Reason    string      `json:"reason"`
+	ChangedAt time.Time   `json:"changed_at"`
+}
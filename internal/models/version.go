@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	SourceHTTP    = "http"
+	SourceKafka   = "kafka"
+	SourceUnknown = "unknown"
+)
+
+// ChangeSource - откуда пришло изменение заказа: транспорт и ссылка на исходный
+// запрос (request id для HTTP, topic/partition/offset для Kafka). ExpectedVersion -
+// версия заказа, на основе которой сделано изменение; 0 - без проверки.
+type ChangeSource struct {
+	Kind            string
+	Ref             string
+	ExpectedVersion int
+}
+
+type changeSourceKey struct{}
+
+// WithChangeSource помечает все заказы, сохраняемые в ctx, одним источником
+func WithChangeSource(ctx context.Context, src ChangeSource) context.Context {
+	return context.WithValue(ctx, changeSourceKey{}, func(int) ChangeSource { return src })
+}
+
+// WithOrderChangeSources задает источник для каждого заказа пачки по его позиции:
+// один заказ может встретиться в пачке несколько раз, и у каждого сообщения свой источник
+func WithOrderChangeSources(ctx context.Context, sources []ChangeSource) context.Context {
+	return context.WithValue(ctx, changeSourceKey{}, func(i int) ChangeSource {
+		if i >= 0 && i < len(sources) {
+			return sources[i]
+		}
+		return ChangeSource{Kind: SourceUnknown}
+	})
+}
+
+// ChangeSourceFrom возвращает источник заказа с позицией i в сохраняемой пачке
+func ChangeSourceFrom(ctx context.Context, i int) ChangeSource {
+	if lookup, ok := ctx.Value(changeSourceKey{}).(func(int) ChangeSource); ok {
+		return lookup(i)
+	}
+	return ChangeSource{Kind: SourceUnknown}
+}
+
+// OrderVersion - неизменяемый снимок заказа после очередного сохранения или смены статуса
+type OrderVersion struct {
+	OrderUID  string          `json:"order_uid"`
+	Version   int             `json:"version"`
+	Source    string          `json:"source"`
+	SourceRef string          `json:"source_ref,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Snapshot  json.RawMessage `json:"snapshot" swaggertype:"object"`
+}
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// FieldChange - изменение одного поля между версиями. Элементы items и payments
+// адресуются ключом (items[rid=...]), остальные массивы - индексом.
+type FieldChange struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+type OrderDiff struct {
+	OrderUID string        `json:"order_uid"`
+	From     int           `json:"from"`
+	To       int           `json:"to"`
+	Changes  []FieldChange `json:"changes"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// WarmStrategy определяет, какие заказы загружаются в кэш при старте
+type WarmStrategy string
+
+const (
+	WarmNewest       WarmStrategy = "newest"
+	WarmRecentlyRead WarmStrategy = "recently_read"
+)
@@ -0,0 +1,8 @@
+package models
+
+// OrderWarning - нарушение доменного правила, с которым заказ все же был сохранен
+type OrderWarning struct {
+	Code    string `json:"code"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
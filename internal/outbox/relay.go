@@ -0,0 +1,160 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"order-manager/internal/config"
+	"order-manager/internal/metrics"
+	"order-manager/internal/models"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const headerEventType = "event-type"
+
+type repository interface {
+	ProcessOutbox(context.Context, int, func(context.Context, []models.OutboxEvent) error) (int, error)
+	DeleteDeliveredOutbox(context.Context, time.Duration) (int64, error)
+}
+
+type writer interface {
+	WriteMessages(context.Context, ...kafka.Message) error
+	Close() error
+}
+
+// Relay публикует события заказов из outbox в Kafka. Доставка at-least-once:
+// событие отмечается доставленным только после подтверждения от брокеров.
+// Ключ сообщения - order_uid, поэтому события одного заказа попадают в одну
+// партицию и читаются в порядке записи.
+type Relay struct {
+	r   repository
+	w   writer
+	log *slog.Logger
+
+	batchSize       int
+	pollInterval    time.Duration
+	cleanupInterval time.Duration
+	retention       time.Duration
+}
+
+func NewRelay(r repository, log *slog.Logger, cfg config.Outbox, brokers string) *Relay {
+	return &Relay{
+		r: r,
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			// пачка событий пишется синхронно под advisory lock: не ждем добора
+			// неполной пачки по партиции (по умолчанию 1с)
+			BatchSize:    max(cfg.BatchSize, 1),
+			BatchTimeout: 10 * time.Millisecond,
+		},
+		log:             log,
+		batchSize:       max(cfg.BatchSize, 1),
+		pollInterval:    cfg.PollInterval,
+		cleanupInterval: cfg.CleanupInterval,
+		retention:       cfg.Retention,
+	}
+}
+
+func (rl *Relay) Start(ctx context.Context) {
+	rl.log.Info("Starting outbox relay")
+	defer func() {
+		if err := rl.w.Close(); err != nil {
+			rl.log.Error("Failed to stop outbox writer", slog.String("error", err.Error()))
+		}
+	}()
+
+	poll := time.NewTicker(rl.pollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(rl.cleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			rl.drain(ctx)
+		case <-cleanup.C:
+			rl.cleanup(ctx)
+		}
+	}
+}
+
+// drain публикует события, пока outbox не опустеет
+func (rl *Relay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := rl.r.ProcessOutbox(ctx, rl.batchSize, rl.publish)
+		if err != nil {
+			if ctx.Err() == nil {
+				rl.log.Error("Failed to relay outbox events", slog.String("error", err.Error()))
+			}
+			return
+		}
+		if n < rl.batchSize {
+			return
+		}
+	}
+}
+
+func (rl *Relay) publish(ctx context.Context, events []models.OutboxEvent) error {
+	messages := make([]kafka.Message, len(events))
+	for i, e := range events {
+		m, err := toMessage(e)
+		if err != nil {
+			return err
+		}
+		messages[i] = m
+	}
+
+	if err := rl.w.WriteMessages(ctx, messages...); err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		metrics.OutboxPublished.WithLabelValues(e.Type).Inc()
+	}
+	rl.log.Info("Published outbox events", slog.Int("count", len(events)), slog.Int64("last_id", events[len(events)-1].ID))
+	return nil
+}
+
+func (rl *Relay) cleanup(ctx context.Context) {
+	deleted, err := rl.r.DeleteDeliveredOutbox(ctx, rl.retention)
+	if err != nil {
+		rl.log.Error("Failed to clean up outbox", slog.String("error", err.Error()))
+		return
+	}
+	if deleted > 0 {
+		rl.log.Info("Cleaned up delivered outbox events", slog.Int64("count", deleted))
+	}
+}
+
+func toMessage(e models.OutboxEvent) (kafka.Message, error) {
+	value, err := json.Marshal(models.OrderEvent{
+		EventID:    e.ID,
+		Type:       e.Type,
+		OrderUID:   e.OrderUID,
+		OccurredAt: e.CreatedAt,
+		Order:      e.Payload,
+	})
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	headers := make([]kafka.Header, 0, len(e.Headers)+1)
+	headers = append(headers, kafka.Header{Key: headerEventType, Value: []byte(e.Type)})
+	for key, value := range e.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+
+	return kafka.Message{
+		Key:     []byte(e.OrderUID),
+		Value:   value,
+		Headers: headers,
+	}, nil
+}
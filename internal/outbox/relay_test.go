@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"order-manager/internal/models"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+type fakeWriter struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.messages = append(w.messages, msgs...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error { return nil }
+
+func TestRelay_PublishKeepsOrderAndKeys(t *testing.T) {
+	t.Parallel()
+
+	w := &fakeWriter{}
+	rl := &Relay{w: w, log: logger}
+
+	created := time.Date(2025, 9, 18, 11, 0, 0, 0, time.UTC)
+	events := []models.OutboxEvent{
+		{ID: 1, OrderUID: "a", Type: models.EventOrderCreated, Payload: []byte(`{"order_uid":"a"}`), CreatedAt: created},
+		{ID: 2, OrderUID: "b", Type: models.EventOrderCreated, Payload: []byte(`{"order_uid":"b"}`), CreatedAt: created},
+		{ID: 3, OrderUID: "a", Type: models.EventOrderUpdated, Payload: []byte(`{"order_uid":"a"}`), CreatedAt: created,
+			Headers: map[string]string{"traceparent": "00-0102-0304-01"}},
+	}
+
+	require.NoError(t, rl.publish(context.Background(), events))
+	require.Len(t, w.messages, 3)
+
+	for i, m := range w.messages {
+		var event models.OrderEvent
+		require.NoError(t, json.Unmarshal(m.Value, &event))
+		assert.Equal(t, events[i].ID, event.EventID)
+		assert.Equal(t, events[i].Type, event.Type)
+		assert.Equal(t, events[i].OrderUID, string(m.Key))
+		assert.JSONEq(t, string(events[i].Payload), string(event.Order))
+	}
+
+	assert.Contains(t, w.messages[2].Headers, kafka.Header{Key: headerEventType, Value: []byte(models.EventOrderUpdated)})
+	assert.Contains(t, w.messages[2].Headers, kafka.Header{Key: "traceparent", Value: []byte("00-0102-0304-01")})
+}
+
+func TestRelay_PublishReturnsWriterError(t *testing.T) {
+	t.Parallel()
+
+	rl := &Relay{w: &fakeWriter{err: assert.AnError}, log: logger}
+	err := rl.publish(context.Background(), []models.OutboxEvent{{ID: 1, OrderUID: "a", Payload: []byte(`{}`)}})
+	assert.ErrorIs(t, err, assert.AnError)
+}
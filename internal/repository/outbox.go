@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"order-manager/internal/models"
+	"time"
+)
+
+// outboxLockKey - ключ advisory-блокировки: события публикует только одна реплика,
+// иначе нарушился бы порядок событий одного заказа
+const outboxLockKey = 7_305_001
+
+// ProcessOutbox выбирает до limit неотправленных событий в порядке записи и передает их
+// в publish. События отмечаются доставленными, только если publish завершился без ошибки,
+// поэтому при сбое они будут отправлены повторно. Возвращает число обработанных событий.
+func (r *Repository) ProcessOutbox(ctx context.Context, limit int, publish func(context.Context, []models.OutboxEvent) error) (int, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	var locked bool
+	if err = tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	queryCtx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	rows, err := tx.Query(queryCtx, `
+		SELECT
+			id, order_uid, event_type, payload, headers, created_at
+		FROM
+			outbox
+		WHERE
+			delivered_at IS NULL
+		ORDER BY
+			id
+		LIMIT $1`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		events []models.OutboxEvent
+		ids    []int64
+	)
+	for rows.Next() {
+		var e models.OutboxEvent
+		if err = rows.Scan(&e.ID, &e.OrderUID, &e.Type, &e.Payload, &e.Headers, &e.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, e)
+		ids = append(ids, e.ID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err = publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	writeCtx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	if _, err = tx.Exec(writeCtx, `UPDATE outbox SET delivered_at = now() WHERE id = ANY($1)`, ids); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(writeCtx); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// DeleteDeliveredOutbox удаляет события, доставленные раньше чем retention назад
+func (r *Repository) DeleteDeliveredOutbox(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM
+			outbox
+		WHERE
+			delivered_at < now() - $1::interval`, retention)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -2,67 +2,93 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"order-manager/internal/config"
 	"order-manager/internal/models"
+	"order-manager/pkg/db"
 	"order-manager/pkg/errorx"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type Repository struct {
-	pool *pgxpool.Pool
+	pool         *pgxpool.Pool
+	instanceID   string
+	queryTimeout time.Duration
+	writeTimeout time.Duration
 }
 
-func NewRepository(pool *pgxpool.Pool) *Repository {
-	return &Repository{pool: pool}
+func NewRepository(pool *pgxpool.Pool, cfg config.Db, instanceID string) *Repository {
+	return &Repository{
+		pool:         pool,
+		instanceID:   instanceID,
+		queryTimeout: cfg.QueryTimeout,
+		writeTimeout: cfg.WriteTimeout,
+	}
+}
+
+// withTimeout ограничивает время операции, чтобы медленный запрос не держал соединение пула бесконечно
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (r *Repository) GetOrderByUID(orderUID string) (*models.Order, error) {
+func (r *Repository) GetOrderByUID(ctx context.Context, orderUID string) (*models.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
 	query := `
 		SELECT
 			o.order_uid, o.track_number, o.entry, o.locate, o.internal_signature,
-			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.off_shard, 
-			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
-			p.transaction, p.request_id, p.currency, p.provider, p.amount, 
-			p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.off_shard, o.warnings, o.status, o.version,
+			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email
 		FROM 
 			orders o
 		JOIN 
 			deliveries d ON d.order_uid = o.order_uid
-		JOIN 
-			payments p ON p.order_uid = o.order_uid
 		WHERE 
 			o.order_uid = $1
 	`
 	var order models.Order
 	var delivery models.Delivery
-	var payment models.Payment
 
-	err := r.pool.QueryRow(context.Background(), query, orderUID).Scan(
+	err := r.pool.QueryRow(ctx, query, orderUID).Scan(
 		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locate, &order.InternalSignature, &order.CustomerID,
-		&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OffShard,
-		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email,
-		&payment.Transaction, &payment.RequestID, &payment.Currency, &payment.Provider, &payment.Amount, &payment.PaymentDt,
-		&payment.Bank, &payment.DeliveryCost, &payment.GoodsTotal, &payment.CustomFee)
+		&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OffShard, &order.Warnings, &order.Status, &order.Version,
+		&delivery.Name, &delivery.Phone, &delivery.Zip, &delivery.City, &delivery.Address, &delivery.Region, &delivery.Email)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, errorx.ErrOrderNotFound
 		}
 		return nil, err
 	}
 
-	item := r.GetItemsByOrderUID(orderUID)
+	item := r.GetItemsByOrderUID(ctx, orderUID)
+
+	payments, err := r.getPaymentsByOrderUIDs(ctx, []string{orderUID})
+	if err != nil {
+		return nil, err
+	}
 
 	order.Delivery = delivery
-	order.Payment = payment
 	order.Item = item
+	order.Payments = payments[orderUID]
+	order.NormalizePayments()
 	return &order, nil
 }
 
-func (r *Repository) GetItemsByOrderUID(orderUID string) []models.Item {
+func (r *Repository) GetItemsByOrderUID(ctx context.Context, orderUID string) []models.Item {
 	var items []models.Item
 	query := `
 		SELECT
@@ -73,7 +99,7 @@ func (r *Repository) GetItemsByOrderUID(orderUID string) []models.Item {
 		WHERE 
 			i.order_uid = $1
 	`
-	rows, err := r.pool.Query(context.Background(), query, orderUID)
+	rows, err := r.pool.Query(ctx, query, orderUID)
 	if err != nil {
 		return nil
 	}
@@ -92,31 +118,114 @@ func (r *Repository) GetItemsByOrderUID(orderUID string) []models.Item {
 	return items
 }
 
-func (r *Repository) SaveOrder(order *models.Order) error {
-	tx, err := r.pool.Begin(context.Background())
+func (r *Repository) SaveOrder(ctx context.Context, order *models.Order) error {
+	return r.SaveOrders(ctx, []*models.Order{order})
+}
+
+// SaveOrders сохраняет заказы одной транзакцией: все запросы отправляются
+// одним pgx.Batch, поэтому пачка заказов стоит одного round-trip
+func (r *Repository) SaveOrders(ctx context.Context, orders []*models.Order) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		log.Fatalf("Error starting transaction: %v", err)
+		return fmt.Errorf("begin transaction: %w", err)
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(context.WithoutCancel(ctx))
 
-	_, err = tx.Exec(context.Background(), `
-		INSERT INTO orders (
-    		order_uid, track_number, entry, locate, internal_signature,
-    		customer_id, delivery_service, shardkey, sm_id, date_created, off_shard
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
-		) 
-		ON CONFLICT(order_uid) 
-		DO UPDATE SET
-			order_uid = $1, track_number = $2, entry = $3, locate = $4, internal_signature = $5,
-    		customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9, date_created = $10, off_shard = $11;`,
-		order.OrderUID, order.TrackNumber, order.Entry, order.Locate, order.InternalSignature, order.CustomerID,
-		order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OffShard)
-	if err != nil {
+	// контекст трассировки сохраняется вместе с событием, чтобы релей продолжил трассу
+	headers := make(map[string]string)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+
+	batch := &pgx.Batch{}
+	for i, order := range orders {
+		payload, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("marshal order %s: %w", order.OrderUID, err)
+		}
+		queueOrder(batch, order, payload, headers, models.ChangeSourceFrom(ctx, i))
+		r.queueNotify(batch, order.OrderUID)
+	}
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
 		return err
 	}
+	return tx.Commit(ctx)
+}
+
+// queueNotify добавляет уведомление для других реплик; Postgres доставит его
+// только после коммита транзакции
+func (r *Repository) queueNotify(batch *pgx.Batch, orderUID string) {
+	payload, _ := json.Marshal(models.OrderNotification{OrderUID: orderUID, Instance: r.instanceID})
+	batch.Queue(`SELECT pg_notify($1, $2)`, db.OrderChangedChannel, string(payload))
+}
 
-	_, err = tx.Exec(context.Background(), `
+// queueOrder добавляет в пачку upsert заказа, событие outbox и новую версию заказа
+// со снимком из события. Тип события определяется по xmax = 0 - так Postgres отличает
+// вставку от обновления в ON CONFLICT. Статус заказа меняется только переходами, поэтому
+// upsert его не трогает, а текущие статус и версия подставляются в снимок и возвращаются
+// в order. Если задана src.ExpectedVersion, а заказа нет или его версия другая, запрос
+// не возвращает строк и пачка завершается ошибкой errorx.ErrVersionConflict.
+func queueOrder(batch *pgx.Batch, order *models.Order, payload []byte, headers map[string]string, src models.ChangeSource) {
+	warnings := order.Warnings
+	if warnings == nil {
+		warnings = []models.OrderWarning{}
+	}
+
+	// version из тела - версия, на основе которой собран заказ: запоздавшее
+	// сообщение со старой версией не перезаписывает более новый заказ
+	payloadVersion := order.Version
+
+	batch.Queue(`
+		WITH upserted AS (
+			INSERT INTO orders (
+    			order_uid, track_number, entry, locate, internal_signature,
+    			customer_id, delivery_service, shardkey, sm_id, date_created, off_shard, warnings
+			) VALUES (
+				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+			) 
+			ON CONFLICT(order_uid) 
+			DO UPDATE SET
+				order_uid = $1, track_number = $2, entry = $3, locate = $4, internal_signature = $5,
+    			customer_id = $6, delivery_service = $7, shardkey = $8, sm_id = $9, date_created = $10, off_shard = $11,
+				warnings = $12, version = orders.version + 1
+			WHERE
+				($19::int = 0 OR orders.version = $19::int) AND ($20::int = 0 OR orders.version <= $20::int)
+			RETURNING (xmax = 0) AS inserted, status, version
+		), event AS (
+			INSERT INTO outbox (order_uid, event_type, payload, headers)
+			SELECT
+				$1, CASE WHEN inserted THEN $13 ELSE $14 END,
+				$15::jsonb || jsonb_build_object('status', status, 'version', version), $16
+			FROM
+				upserted
+			WHERE
+				$19::int = 0 OR NOT inserted
+			RETURNING
+				payload
+		)
+		INSERT INTO order_versions (order_uid, version, source, source_ref, snapshot)
+		SELECT
+			$1, upserted.version, $17, $18, event.payload
+		FROM
+			event, upserted
+		RETURNING
+			snapshot->>'status', version;`,
+		order.OrderUID, order.TrackNumber, order.Entry, order.Locate, order.InternalSignature, order.CustomerID,
+		order.DeliveryService, order.Shardkey, order.SmID, order.DateCreated, order.OffShard, warnings,
+		models.EventOrderCreated, models.EventOrderUpdated, payload, headers, src.Kind, src.Ref, src.ExpectedVersion,
+		payloadVersion,
+	).QueryRow(func(row pgx.Row) error {
+		err := row.Scan(&order.Status, &order.Version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: order %s, expected version %d, payload version %d",
+				errorx.ErrVersionConflict, order.OrderUID, src.ExpectedVersion, payloadVersion)
+		}
+		return err
+	})
+
+	batch.Queue(`
 		INSERT INTO deliveries (
     		order_uid, name, phone, zip, city, address, region, email
 		) VALUES (
@@ -127,28 +236,51 @@ func (r *Repository) SaveOrder(order *models.Order) error {
 			order_uid = $1, name = $2, phone = $3, zip = $4, city = $5, address = $6, region = $7, email = $8;`,
 		order.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip,
 		order.Delivery.City, order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
-	if err != nil {
-		return err
+
+	// список оплат, как и товары, передается целиком: транзакции, которых нет
+	// в новой версии заказа, удаляются
+	transactions := make([]string, len(order.Payments))
+	for i, p := range order.Payments {
+		transactions[i] = p.Transaction
 	}
+	batch.Queue(`DELETE FROM payments WHERE order_uid = $1 AND transaction <> ALL($2);`, order.OrderUID, transactions)
 
-	_, err = tx.Exec(context.Background(), `
+	queryPayments := `
 		INSERT INTO payments (
 			order_uid, transaction, request_id, currency, provider, 
-			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
+			amount, payment_dt, bank, delivery_cost, goods_total, custom_fee, type
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 		) 
 		ON CONFLICT (transaction)
 		DO UPDATE SET
-			order_uid = $1, transaction = $2, request_id = $3, currency = $4, provider = $5, 
-			amount = $6, payment_dt = $7, bank = $8, delivery_cost = $9, goods_total = $10, custom_fee = $11;`,
-		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency, order.Payment.Provider,
-		order.Payment.Amount, order.Payment.PaymentDt, order.Payment.Bank, order.Payment.DeliveryCost,
-		order.Payment.GoodsTotal, order.Payment.CustomFee)
-	if err != nil {
-		return err
+			request_id = $3, currency = $4, provider = $5, 
+			amount = $6, payment_dt = $7, bank = $8, delivery_cost = $9, goods_total = $10, custom_fee = $11, type = $12
+		WHERE
+			payments.order_uid = EXCLUDED.order_uid;`
+
+	for _, p := range order.Payments {
+		transaction := p.Transaction
+		batch.Queue(queryPayments,
+			order.OrderUID, p.Transaction, p.RequestID, p.Currency, p.Provider,
+			p.Amount, p.PaymentDt, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee, p.Type,
+		).Exec(func(ct pgconn.CommandTag) error {
+			if ct.RowsAffected() == 0 {
+				return fmt.Errorf("%w: transaction %s, order %s", errorx.ErrPaymentConflict, transaction, order.OrderUID)
+			}
+			return nil
+		})
+	}
+
+	// товары заменяются целиком: строки, которых нет в новой версии заказа, удаляются
+	rids := make([]string, len(order.Item))
+	for i, item := range order.Item {
+		rids[i] = item.Rid
 	}
+	batch.Queue(`DELETE FROM items WHERE order_uid = $1 AND rid <> ALL($2);`, order.OrderUID, rids)
 
+	// WHERE не дает перенести строку товара в другой заказ: при совпадении rid
+	// с товаром чужого заказа upsert ничего не меняет
 	queryItems := `
 		INSERT INTO items (
     		order_uid, chrt_id, track_number, price, rid, name_item, 
@@ -158,50 +290,330 @@ func (r *Repository) SaveOrder(order *models.Order) error {
 		) 
 		ON CONFLICT (rid) 
 		DO UPDATE SET
-			order_uid = $1, chrt_id = $2, track_number = $3, price = $4, rid = $5, name_item = $6, 
-    		sale = $7, size = $8, total_price = $9, nm_id = $10, brand = $11, status = $12;`
+			chrt_id = $2, track_number = $3, price = $4, name_item = $6, 
+    		sale = $7, size = $8, total_price = $9, nm_id = $10, brand = $11, status = $12
+		WHERE
+			items.order_uid = EXCLUDED.order_uid;`
 
 	for _, item := range order.Item {
-		_, err = tx.Exec(context.Background(), queryItems,
+		rid := item.Rid
+		batch.Queue(queryItems,
 			order.OrderUID,
 			item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.NameItem,
 			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status,
-		)
+		).Exec(func(ct pgconn.CommandTag) error {
+			if ct.RowsAffected() == 0 {
+				return fmt.Errorf("%w: rid %s, order %s", errorx.ErrItemConflict, rid, order.OrderUID)
+			}
+			return nil
+		})
+	}
+}
+
+// GetAllOrders загружает до size заказов для прогрева кэша тремя запросами:
+// заказы с доставкой одним JOIN, товары и оплаты - по одному ANY($1)
+func (r *Repository) GetAllOrders(ctx context.Context, size int, strategy models.WarmStrategy) ([]models.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	orderBy := "o.date_created DESC, o.order_uid DESC"
+	if strategy == models.WarmRecentlyRead {
+		orderBy = "o.last_read_at DESC NULLS LAST, o.date_created DESC, o.order_uid DESC"
+	}
+
+	query := ordersSelect + `
+		ORDER BY
+			` + orderBy + `
+		LIMIT
+			$1
+	`
+	rows, err := r.pool.Query(ctx, query, size)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := scanOrders(rows, size)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.attachItems(ctx, orders); err != nil {
+		return nil, err
+	}
+	return orders, r.attachPayments(ctx, orders)
+}
+
+// TouchOrders отмечает время последнего чтения заказов
+func (r *Repository) TouchOrders(ctx context.Context, orderUIDs []string) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx, `
+		UPDATE
+			orders
+		SET
+			last_read_at = now()
+		WHERE
+			order_uid = ANY($1)`, orderUIDs)
+	return err
+}
+
+func (r *Repository) ListOrders(ctx context.Context, filter models.OrderFilter) ([]models.Order, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	var (
+		conds []string
+		args  []any
+	)
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.CustomerID != "" {
+		where("o.customer_id = $%d", filter.CustomerID)
+	}
+	if filter.TrackNumber != "" {
+		where("o.track_number = $%d", filter.TrackNumber)
+	}
+	if filter.DeliveryService != "" {
+		where("o.delivery_service = $%d", filter.DeliveryService)
+	}
+	if filter.Entry != "" {
+		where("o.entry = $%d", filter.Entry)
+	}
+	if filter.Locale != "" {
+		where("o.locate = $%d", filter.Locale)
+	}
+	if filter.DateFrom != nil {
+		where("o.date_created >= $%d", *filter.DateFrom)
+	}
+	if filter.DateTo != nil {
+		where("o.date_created < $%d", *filter.DateTo)
+	}
+	if filter.After != nil {
+		args = append(args, filter.After.DateCreated, filter.After.OrderUID)
+		conds = append(conds, fmt.Sprintf("(o.date_created, o.order_uid) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := ordersSelect
+	if len(conds) > 0 {
+		query += `
+		WHERE
+			` + strings.Join(conds, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(`
+		ORDER BY
+			o.date_created DESC, o.order_uid DESC
+		LIMIT
+			$%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := scanOrders(rows, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.attachItems(ctx, orders); err != nil {
+		return nil, err
+	}
+	return orders, r.attachPayments(ctx, orders)
+}
+
+const ordersSelect = `
+		SELECT
+			o.order_uid, o.track_number, o.entry, o.locate, o.internal_signature,
+			o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.off_shard, o.warnings, o.status, o.version,
+			d.name, d.phone, d.zip, d.city, d.address, d.region, d.email
+		FROM
+			orders o
+		JOIN
+			deliveries d ON d.order_uid = o.order_uid`
+
+func scanOrders(rows pgx.Rows, sizeHint int) ([]models.Order, error) {
+	defer rows.Close()
+
+	orders := make([]models.Order, 0, sizeHint)
+	for rows.Next() {
+		var order models.Order
+		err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locate, &order.InternalSignature, &order.CustomerID,
+			&order.DeliveryService, &order.Shardkey, &order.SmID, &order.DateCreated, &order.OffShard, &order.Warnings, &order.Status, &order.Version,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip, &order.Delivery.City,
+			&order.Delivery.Address, &order.Delivery.Region, &order.Delivery.Email)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+func (r *Repository) attachItems(ctx context.Context, orders []models.Order) error {
+	uids := make([]string, len(orders))
+	for i := range orders {
+		uids[i] = orders[i].OrderUID
+	}
+
+	items, err := r.getItemsByOrderUIDs(ctx, uids)
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		orders[i].Item = items[orders[i].OrderUID]
+	}
+	return nil
+}
+
+func (r *Repository) attachPayments(ctx context.Context, orders []models.Order) error {
+	uids := make([]string, len(orders))
+	for i := range orders {
+		uids[i] = orders[i].OrderUID
+	}
+
+	payments, err := r.getPaymentsByOrderUIDs(ctx, uids)
+	if err != nil {
+		return err
+	}
+	for i := range orders {
+		orders[i].Payments = payments[orders[i].OrderUID]
+		orders[i].NormalizePayments()
 	}
-	return tx.Commit(context.Background())
+	return nil
 }
 
-func (r *Repository) GetAllOrders(size int) ([]models.Order, error) {
-	var orders []models.Order
+func (r *Repository) getPaymentsByOrderUIDs(ctx context.Context, orderUIDs []string) (map[string][]models.Payment, error) {
+	payments := make(map[string][]models.Payment, len(orderUIDs))
+	if len(orderUIDs) == 0 {
+		return payments, nil
+	}
+
 	query := `
-		SELECT 
-			order_uid
-		FROM 
-			orders
+		SELECT
+			p.order_uid, p.transaction, p.type, p.request_id, p.currency, p.provider, p.amount,
+			p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+		FROM
+			payments p
+		WHERE
+			p.order_uid = ANY($1)
 		ORDER BY
-			date_created
-		LIMIT  
-			$1
+			p.payment_dt, p.transaction
 	`
-	rows, err := r.pool.Query(context.Background(), query, size)
+	rows, err := r.pool.Query(ctx, query, orderUIDs)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var orderUID string
-		if err = rows.Scan(&orderUID); err != nil {
-			continue
+		var p models.Payment
+		err = rows.Scan(
+			&p.OrderUID, &p.Transaction, &p.Type, &p.RequestID, &p.Currency, &p.Provider, &p.Amount,
+			&p.PaymentDt, &p.Bank, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
+		if err != nil {
+			return nil, err
 		}
+		payments[p.OrderUID] = append(payments[p.OrderUID], p)
+	}
+	return payments, rows.Err()
+}
+
+func (r *Repository) getItemsByOrderUIDs(ctx context.Context, orderUIDs []string) (map[string][]models.Item, error) {
+	items := make(map[string][]models.Item, len(orderUIDs))
+	if len(orderUIDs) == 0 {
+		return items, nil
+	}
 
-		order, err := r.GetOrderByUID(orderUID)
+	query := `
+		SELECT
+			i.order_uid, i.chrt_id, i.track_number, i.price, i.rid, i.name_item,
+			i.sale, i.size, i.total_price, i.nm_id, i.brand, i.status
+		FROM
+			items i
+		WHERE
+			i.order_uid = ANY($1)
+		ORDER BY
+			i.id
+	`
+	rows, err := r.pool.Query(ctx, query, orderUIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.Item
+		err = rows.Scan(
+			&item.OrderUID, &item.ChrtID, &item.TrackNumber, &item.Price, &item.Rid,
+			&item.NameItem, &item.Sale, &item.Size, &item.TotalPrice,
+			&item.NmID, &item.Brand, &item.Status)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		orders = append(orders, *order)
+		items[item.OrderUID] = append(items[item.OrderUID], item)
+	}
+	return items, rows.Err()
+}
+
+// ReserveIdempotencyKey занимает ключ под новый запрос. Если ключ уже есть,
+// возвращает сохраненную запись; зависшая незавершенная резервация перехватывается.
+func (r *Repository) ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, error) {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	var reserved string
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO idempotency_keys (key, request_hash)
+		VALUES ($1, $2)
+		ON CONFLICT (key)
+		DO UPDATE SET
+			request_hash = EXCLUDED.request_hash, created_at = now()
+		WHERE
+			idempotency_keys.status_code = 0 AND idempotency_keys.created_at < now() - interval '1 minute'
+		RETURNING key`, key, requestHash).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	record := models.IdempotencyRecord{Key: key}
+	err = r.pool.QueryRow(ctx, `
+		SELECT
+			request_hash, status_code, headers, response_body, created_at
+		FROM
+			idempotency_keys
+		WHERE
+			key = $1`, key).Scan(&record.RequestHash, &record.StatusCode, &record.Headers, &record.Body, &record.CreatedAt)
+	if err != nil {
+		return nil, err
 	}
-	return orders, nil
+	return &record, nil
+}
+
+func (r *Repository) SaveIdempotentResponse(ctx context.Context, key string, statusCode int, headers map[string]string, body []byte) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx, `
+		UPDATE
+			idempotency_keys
+		SET
+			status_code = $2, headers = $3, response_body = $4
+		WHERE
+			key = $1`, key, statusCode, headers, body)
+	return err
+}
+
+func (r *Repository) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	_, err := r.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE key = $1`, key)
+	return err
 }
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"order-manager/internal/models"
+	"order-manager/pkg/errorx"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// ChangeOrderStatus переводит заказ в статус change.To, записывает переход в историю
+// и событие order.updated в outbox.
+// Текущий статус читается под блокировкой строки и передается в check: если check
+// возвращает ошибку, переход не выполняется. Переход увеличивает версию заказа; если в ctx
+// задана ожидаемая версия и она не совпадает, возвращается errorx.ErrVersionConflict.
+// change.From и change.ChangedAt заполняются.
+func (r *Repository) ChangeOrderStatus(ctx context.Context, change *models.StatusChange, check func(from models.OrderStatus) error) error {
+	ctx, cancel := withTimeout(ctx, r.writeTimeout)
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	var version int
+	err = tx.QueryRow(ctx, `SELECT status, version FROM orders WHERE order_uid = $1 FOR UPDATE`, change.OrderUID).
+		Scan(&change.From, &version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errorx.ErrOrderNotFound
+		}
+		return err
+	}
+
+	src := models.ChangeSourceFrom(ctx, 0)
+	if src.ExpectedVersion != 0 && src.ExpectedVersion != version {
+		return fmt.Errorf("%w: order %s, expected version %d, current %d",
+			errorx.ErrVersionConflict, change.OrderUID, src.ExpectedVersion, version)
+	}
+	if err = check(change.From); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	batch.Queue(`UPDATE orders SET status = $2, version = $3 WHERE order_uid = $1`, change.OrderUID, change.To, version+1)
+	batch.Queue(`
+		INSERT INTO order_status_history (
+			order_uid, from_status, to_status, source, reason
+		) VALUES (
+			$1, $2, $3, $4, $5
+		)
+		RETURNING
+			changed_at`,
+		change.OrderUID, change.From, change.To, change.Source, change.Reason,
+	).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&change.ChangedAt)
+	})
+
+	// смена статуса - тоже версия заказа: последний снимок с новым статусом. Тот же снимок
+	// уходит в outbox, чтобы потребители узнали о переходе так же, как о сохранении заказа
+	headers := make(map[string]string)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+	batch.Queue(`
+		WITH latest AS (
+			SELECT
+				snapshot || jsonb_build_object('status', $4::text, 'version', $5::int) AS snapshot
+			FROM
+				order_versions
+			WHERE
+				order_uid = $1
+			ORDER BY
+				version DESC
+			LIMIT 1
+		), event AS (
+			INSERT INTO outbox (order_uid, event_type, payload, headers)
+			SELECT
+				$1, $6, snapshot, $7
+			FROM
+				latest
+			RETURNING
+				payload
+		)
+		INSERT INTO order_versions (order_uid, version, source, source_ref, snapshot)
+		SELECT
+			$1, $5::int, $2, $3, payload
+		FROM
+			event`,
+		change.OrderUID, change.Source, src.Ref, change.To, version+1, models.EventOrderUpdated, headers,
+	).Exec(func(ct pgconn.CommandTag) error {
+		// без снимка переход не попал бы ни в историю, ни в outbox, а версия заказа уже выросла
+		if ct.RowsAffected() == 0 {
+			return fmt.Errorf("order %s has no version snapshot", change.OrderUID)
+		}
+		return nil
+	})
+	r.queueNotify(batch, change.OrderUID)
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
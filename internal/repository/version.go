@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"order-manager/internal/models"
+)
+
+// GetOrderVersions возвращает все версии заказа по возрастанию номера
+func (r *Repository) GetOrderVersions(ctx context.Context, orderUID string) ([]models.OrderVersion, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT
+			order_uid, version, source, source_ref, snapshot, created_at
+		FROM
+			order_versions
+		WHERE
+			order_uid = $1
+		ORDER BY
+			version`, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []models.OrderVersion
+	for rows.Next() {
+		var v models.OrderVersion
+		if err = rows.Scan(&v.OrderUID, &v.Version, &v.Source, &v.SourceRef, &v.Snapshot, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetCurrentVersions возвращает текущие версии заказов одним запросом; заказов,
+// которых нет в БД, в результате нет
+func (r *Repository) GetCurrentVersions(ctx context.Context, orderUIDs []string) (map[string]int, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	rows, err := r.pool.Query(ctx, `SELECT order_uid, version FROM orders WHERE order_uid = ANY($1)`, orderUIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]int, len(orderUIDs))
+	for rows.Next() {
+		var (
+			orderUID string
+			version  int
+		)
+		if err = rows.Scan(&orderUID, &version); err != nil {
+			return nil, err
+		}
+		versions[orderUID] = version
+	}
+	return versions, rows.Err()
+}
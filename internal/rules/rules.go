@@ -0,0 +1,209 @@
+package rules
+
+import (
+	"fmt"
+	"order-manager/internal/models"
+)
+
+type Severity string
+
+const (
+	// SeverityReject - заказ с таким нарушением не сохраняется
+	SeverityReject Severity = "reject"
+	// SeverityWarn - заказ сохраняется, нарушение записывается вместе с ним
+	SeverityWarn Severity = "warn"
+)
+
+const (
+	CodeGoodsTotalMismatch     = "GOODS_TOTAL_MISMATCH"
+	CodeAmountMismatch         = "AMOUNT_MISMATCH"
+	CodeItemTotalPriceMismatch = "ITEM_TOTAL_PRICE_MISMATCH"
+	CodeItemTrackMismatch      = "ITEM_TRACK_NUMBER_MISMATCH"
+
+	CodePaymentTypeInvalid        = "PAYMENT_TYPE_INVALID"
+	CodePaymentAmountInvalid      = "PAYMENT_AMOUNT_INVALID"
+	CodePaymentTransactionInvalid = "PAYMENT_TRANSACTION_INVALID"
+	CodePaymentCurrencyMismatch   = "PAYMENT_CURRENCY_MISMATCH"
+	CodeRefundExceedsPaid         = "REFUND_EXCEEDS_PAID"
+)
+
+// Issue - одно нарушение правила в конкретном поле заказа
+type Issue struct {
+	Field   string
+	Message string
+}
+
+type Rule struct {
+	Code     string
+	Severity Severity
+	Check    func(order *models.Order) []Issue
+}
+
+type Violation struct {
+	Code     string
+	Severity Severity
+	Field    string
+	Message  string
+}
+
+// Validator проверяет согласованность заказа набором доменных правил
+type Validator struct {
+	rules []Rule
+}
+
+func NewValidator(rules ...Rule) *Validator {
+	return &Validator{rules: rules}
+}
+
+// Default - правила согласованности сумм, товаров и транзакций оплаты заказа.
+// Правила оплаты рассчитаны на заказ после models.Order.NormalizePayments.
+func Default() *Validator {
+	return NewValidator(
+		Rule{Code: CodeGoodsTotalMismatch, Severity: SeverityReject, Check: checkGoodsTotal},
+		Rule{Code: CodeAmountMismatch, Severity: SeverityReject, Check: checkAmount},
+		Rule{Code: CodeItemTotalPriceMismatch, Severity: SeverityWarn, Check: checkItemTotalPrice},
+		Rule{Code: CodeItemTrackMismatch, Severity: SeverityWarn, Check: checkItemTrackNumber},
+		Rule{Code: CodePaymentTypeInvalid, Severity: SeverityReject, Check: checkPaymentType},
+		Rule{Code: CodePaymentAmountInvalid, Severity: SeverityReject, Check: checkPaymentAmount},
+		Rule{Code: CodePaymentTransactionInvalid, Severity: SeverityReject, Check: checkPaymentTransaction},
+		Rule{Code: CodePaymentCurrencyMismatch, Severity: SeverityReject, Check: checkPaymentCurrency},
+		Rule{Code: CodeRefundExceedsPaid, Severity: SeverityReject, Check: checkNetPaid},
+	)
+}
+
+func (v *Validator) Check(order *models.Order) []Violation {
+	var violations []Violation
+	for _, rule := range v.rules {
+		for _, issue := range rule.Check(order) {
+			violations = append(violations, Violation{
+				Code:     rule.Code,
+				Severity: rule.Severity,
+				Field:    issue.Field,
+				Message:  issue.Message,
+			})
+		}
+	}
+	return violations
+}
+
+func checkGoodsTotal(order *models.Order) []Issue {
+	sum := 0
+	for _, item := range order.Item {
+		sum += item.TotalPrice
+	}
+	if order.Payment.GoodsTotal != sum {
+		return []Issue{{
+			Field:   "payment.goods_total",
+			Message: fmt.Sprintf("goods_total %d does not equal sum of items total_price %d", order.Payment.GoodsTotal, sum),
+		}}
+	}
+	return nil
+}
+
+func checkAmount(order *models.Order) []Issue {
+	p := &order.Payment
+	expected := p.GoodsTotal + p.DeliveryCost + p.CustomFee
+	if p.Amount != expected {
+		return []Issue{{
+			Field:   "payment.amount",
+			Message: fmt.Sprintf("amount %d does not equal goods_total + delivery_cost + custom_fee %d", p.Amount, expected),
+		}}
+	}
+	return nil
+}
+
+// checkItemTotalPrice допускает расхождение в единицу из-за округления скидки
+func checkItemTotalPrice(order *models.Order) []Issue {
+	var issues []Issue
+	for i, item := range order.Item {
+		expected := item.Price * (100 - item.Sale) / 100
+		if diff := item.TotalPrice - expected; diff > 1 || diff < -1 {
+			issues = append(issues, Issue{
+				Field: fmt.Sprintf("items[%d].total_price", i),
+				Message: fmt.Sprintf("total_price %d does not match price %d with sale %d%% (expected %d)",
+					item.TotalPrice, item.Price, item.Sale, expected),
+			})
+		}
+	}
+	return issues
+}
+
+func checkItemTrackNumber(order *models.Order) []Issue {
+	var issues []Issue
+	for i, item := range order.Item {
+		if item.TrackNumber != order.TrackNumber {
+			issues = append(issues, Issue{
+				Field:   fmt.Sprintf("items[%d].track_number", i),
+				Message: fmt.Sprintf("track_number %q does not match order track_number %q", item.TrackNumber, order.TrackNumber),
+			})
+		}
+	}
+	return issues
+}
+
+func checkPaymentType(order *models.Order) []Issue {
+	var issues []Issue
+	for i, p := range order.Payments {
+		if models.PaymentSign(p.Type) == 0 {
+			issues = append(issues, Issue{
+				Field:   fmt.Sprintf("payments[%d].type", i),
+				Message: fmt.Sprintf("unknown payment type %q", p.Type),
+			})
+		}
+	}
+	return issues
+}
+
+func checkPaymentAmount(order *models.Order) []Issue {
+	var issues []Issue
+	for i, p := range order.Payments {
+		if p.Amount <= 0 {
+			issues = append(issues, Issue{
+				Field:   fmt.Sprintf("payments[%d].amount", i),
+				Message: fmt.Sprintf("amount %d must be positive, direction is set by type", p.Amount),
+			})
+		}
+	}
+	return issues
+}
+
+func checkPaymentTransaction(order *models.Order) []Issue {
+	var issues []Issue
+	seen := make(map[string]struct{}, len(order.Payments))
+	for i, p := range order.Payments {
+		field := fmt.Sprintf("payments[%d].transaction", i)
+		if p.Transaction == "" {
+			issues = append(issues, Issue{Field: field, Message: "transaction is required"})
+			continue
+		}
+		if _, ok := seen[p.Transaction]; ok {
+			issues = append(issues, Issue{Field: field, Message: fmt.Sprintf("duplicate transaction %q", p.Transaction)})
+			continue
+		}
+		seen[p.Transaction] = struct{}{}
+	}
+	return issues
+}
+
+func checkPaymentCurrency(order *models.Order) []Issue {
+	var issues []Issue
+	for i, p := range order.Payments {
+		if p.Currency != order.Payment.Currency {
+			issues = append(issues, Issue{
+				Field:   fmt.Sprintf("payments[%d].currency", i),
+				Message: fmt.Sprintf("currency %q does not match order currency %q", p.Currency, order.Payment.Currency),
+			})
+		}
+	}
+	return issues
+}
+
+func checkNetPaid(order *models.Order) []Issue {
+	if order.NetPaid < 0 {
+		return []Issue{{
+			Field:   "payments",
+			Message: fmt.Sprintf("refunds and chargebacks exceed charged amount, net paid %d", order.NetPaid),
+		}}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package rules_test
+
+import (
+	"order-manager/internal/models"
+	"order-manager/internal/rules"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validOrder повторяет тестовый заказ из миграции с тестовыми данными
+func validOrder() *models.Order {
+	order := &models.Order{
+		TrackNumber: "WBILMTESTTRACK",
+		Payment: models.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Type:         models.PaymentCharge,
+			Currency:     "USD",
+			Amount:       1817,
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Item: []models.Item{
+			{TrackNumber: "WBILMTESTTRACK", Price: 453, Sale: 30, TotalPrice: 317},
+		},
+	}
+	order.NormalizePayments()
+	return order
+}
+
+func codes(violations []rules.Violation) []string {
+	result := make([]string, len(violations))
+	for i, v := range violations {
+		result[i] = v.Code
+	}
+	return result
+}
+
+func TestDefault_ValidOrder(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, rules.Default().Check(validOrder()))
+}
+
+func TestDefault_GoodsTotalAndAmountMismatch(t *testing.T) {
+	t.Parallel()
+
+	order := validOrder()
+	order.Payment.GoodsTotal = 300
+
+	violations := rules.Default().Check(order)
+	require.Equal(t, []string{rules.CodeGoodsTotalMismatch, rules.CodeAmountMismatch}, codes(violations))
+	assert.Equal(t, rules.SeverityReject, violations[0].Severity)
+	assert.Equal(t, "payment.goods_total", violations[0].Field)
+	assert.Equal(t, "payment.amount", violations[1].Field)
+}
+
+func TestDefault_ItemWarnings(t *testing.T) {
+	t.Parallel()
+
+	order := validOrder()
+	order.Item = append(order.Item, models.Item{TrackNumber: "OTHER", Price: 100, Sale: 10, TotalPrice: 50})
+	order.Payment.GoodsTotal = 367
+	order.Payment.Amount = 1867
+
+	violations := rules.Default().Check(order)
+	require.Equal(t, []string{rules.CodeItemTotalPriceMismatch, rules.CodeItemTrackMismatch}, codes(violations))
+	for _, v := range violations {
+		assert.Equal(t, rules.SeverityWarn, v.Severity)
+	}
+	assert.Equal(t, "items[1].total_price", violations[0].Field)
+	assert.Equal(t, "items[1].track_number", violations[1].Field)
+}
+
+func TestDefault_TotalPriceRoundingTolerated(t *testing.T) {
+	t.Parallel()
+
+	order := validOrder()
+	// 453 * 0.7 = 317.1, округление вверх тоже допустимо
+	order.Item[0].TotalPrice = 318
+	order.Payment.GoodsTotal = 318
+	order.Payment.Amount = 1818
+
+	assert.Empty(t, rules.Default().Check(order))
+}
+
+func TestDefault_PaymentsViolations(t *testing.T) {
+	t.Parallel()
+
+	order := validOrder()
+	order.Payments = append(order.Payments,
+		models.Payment{Transaction: "b563feb7b2b84b6test", Type: "void", Currency: "USD", Amount: 100},
+		models.Payment{Transaction: "refund-1", Type: models.PaymentRefund, Currency: "EUR", Amount: 0},
+	)
+	order.NormalizePayments()
+
+	violations := rules.Default().Check(order)
+	require.Equal(t, []string{
+		rules.CodePaymentTypeInvalid,
+		rules.CodePaymentAmountInvalid,
+		rules.CodePaymentTransactionInvalid,
+		rules.CodePaymentCurrencyMismatch,
+	}, codes(violations))
+	assert.Equal(t, "payments[1].type", violations[0].Field)
+	assert.Equal(t, "payments[2].amount", violations[1].Field)
+	assert.Equal(t, "payments[1].transaction", violations[2].Field)
+	assert.Equal(t, "payments[2].currency", violations[3].Field)
+}
+
+func TestDefault_RefundExceedsPaid(t *testing.T) {
+	t.Parallel()
+
+	order := validOrder()
+	order.Payments = append(order.Payments,
+		models.Payment{Transaction: "refund-1", Type: models.PaymentRefund, Currency: "USD", Amount: 1000},
+		models.Payment{Transaction: "chargeback-1", Type: models.PaymentChargeback, Currency: "USD", Amount: 1000},
+	)
+	order.NormalizePayments()
+
+	violations := rules.Default().Check(order)
+	require.Equal(t, []string{rules.CodeRefundExceedsPaid}, codes(violations))
+	assert.Equal(t, -183, order.NetPaid)
+}
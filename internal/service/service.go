@@ -1,88 +1,597 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"order-manager/internal/history"
+	"order-manager/internal/metrics"
 	"order-manager/internal/models"
+	"order-manager/internal/rules"
 	"order-manager/pkg/errorx"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 type repository interface {
-	GetOrderByUID(string) (*models.Order, error)
-	SaveOrder(*models.Order) error
-	GetAllOrders(int) ([]models.Order, error)
+	GetOrderByUID(context.Context, string) (*models.Order, error)
+	SaveOrder(context.Context, *models.Order) error
+	SaveOrders(context.Context, []*models.Order) error
+	GetAllOrders(context.Context, int, models.WarmStrategy) ([]models.Order, error)
+	TouchOrders(context.Context, []string) error
+	ListOrders(context.Context, models.OrderFilter) ([]models.Order, error)
+	ReserveIdempotencyKey(context.Context, string, string) (*models.IdempotencyRecord, error)
+	SaveIdempotentResponse(context.Context, string, int, map[string]string, []byte) error
+	DeleteIdempotencyKey(context.Context, string) error
+	ChangeOrderStatus(context.Context, *models.StatusChange, func(models.OrderStatus) error) error
+	GetOrderVersions(context.Context, string) ([]models.OrderVersion, error)
+	GetCurrentVersions(context.Context, []string) (map[string]int, error)
 }
 
 type cache interface {
-	SetOrder(models.Order)
-	GetOrder(string) (models.Order, bool)
+	SetOrder(context.Context, models.Order)
+	GetOrder(context.Context, string) (models.Order, bool)
+	SetNotFound(context.Context, string)
+	IsNotFound(context.Context, string) bool
+	Delete(context.Context, string) bool
+	Versions() map[string]int
 }
 
+var tracer = otel.Tracer("order-manager/internal/service")
+
+// errStatusUnchanged - заказ уже в запрошенном статусе; повторная доставка
+// того же перехода не считается ошибкой и не пишется в историю
+var errStatusUnchanged = errors.New("order status unchanged")
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
 type Service struct {
 	r         repository
 	c         cache
 	log       *slog.Logger
 	validator *validator.Validate
+	rules     *rules.Validator
+	loads     singleflight.Group
+
+	// order_uid прочитанных заказов, ждущие записи last_read_at; nil, если учет чтений выключен
+	readsMu sync.Mutex
+	reads   map[string]struct{}
 }
 
 func NewService(r repository, c cache, log *slog.Logger) *Service {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
 	return &Service{
 		r:         r,
 		c:         c,
 		log:       log,
-		validator: validator.New(),
+		validator: v,
+		rules:     rules.Default(),
 	}
 }
 
-func (s *Service) GetOrderByUID(orderUID string) (*models.Order, error) {
-	if order, found := s.c.GetOrder(orderUID); found {
+func (s *Service) GetOrderByUID(ctx context.Context, orderUID string) (_ *models.Order, err error) {
+	ctx, span := tracer.Start(ctx, "Service.GetOrderByUID", trace.WithAttributes(attribute.String("order.uid", orderUID)))
+	defer func() { finishSpan(span, err) }()
+
+	s.recordRead(orderUID)
+
+	if order, found := s.c.GetOrder(ctx, orderUID); found {
 		slog.Info("Got order from cache", slog.String("order_uid", orderUID))
 		return &order, nil
 	}
 
-	order, err := s.r.GetOrderByUID(orderUID)
+	if s.c.IsNotFound(ctx, orderUID) {
+		s.log.Debug("Order not found (negative cache)", slog.String("order_uid", orderUID))
+		return nil, errorx.ErrOrderNotFound
+	}
+
+	// одновременные промахи по одному order_uid схлопываются в один запрос к БД;
+	// загрузка не отменяется вместе с первым вызвавшим, но каждый ждет не дольше своего ctx
+	ch := s.loads.DoChan(orderUID, func() (any, error) {
+		return s.loadOrder(context.WithoutCancel(ctx), orderUID)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		order := *res.Val.(*models.Order)
+		return &order, nil
+	}
+}
+
+func (s *Service) loadOrder(ctx context.Context, orderUID string) (*models.Order, error) {
+	order, err := s.r.GetOrderByUID(ctx, orderUID)
 	if err != nil {
 		if errors.Is(err, errorx.ErrOrderNotFound) {
 			s.log.Warn("Order not found", slog.String("order_uid", orderUID))
+			s.c.SetNotFound(ctx, orderUID)
 			return nil, err
 		}
 		s.log.Error("Failed to get order", slog.String("error", err.Error()))
 		return nil, errorx.ErrInternal
 	}
 
+	s.c.SetOrder(ctx, *order)
+
 	s.log.Info("Got order from db", slog.String("order_uid", orderUID))
 	return order, nil
 }
 
-func (s *Service) SaveOrder(order *models.Order) error {
+// InvalidateOrder убирает заказ из кэша после его изменения другой репликой
+func (s *Service) InvalidateOrder(ctx context.Context, orderUID string) {
+	if s.c.Delete(ctx, orderUID) {
+		s.log.Info("Invalidated cached order", slog.String("order_uid", orderUID))
+	}
+}
+
+// ReconcileCache сверяет версии закэшированных заказов с БД и убирает устаревшие
+// и удаленные: изменения, сделанные, пока реплика не слушала уведомления, иначе
+// остались бы в кэше навсегда. Возвращает число убранных заказов.
+func (s *Service) ReconcileCache(ctx context.Context) (int, error) {
+	cached := s.c.Versions()
+	if len(cached) == 0 {
+		return 0, nil
+	}
+
+	orderUIDs := make([]string, 0, len(cached))
+	for orderUID := range cached {
+		orderUIDs = append(orderUIDs, orderUID)
+	}
+	current, err := s.r.GetCurrentVersions(ctx, orderUIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	stale := 0
+	for orderUID, version := range cached {
+		if v, found := current[orderUID]; found && v == version {
+			continue
+		}
+		if s.c.Delete(ctx, orderUID) {
+			stale++
+		}
+	}
+
+	s.log.Info("Cache reconciled with db", slog.Int("orders", len(cached)), slog.Int("stale", stale))
+	return stale, nil
+}
+
+// RefreshOrder перечитывает из БД заказ, измененный другой репликой, если он был в кэше
+func (s *Service) RefreshOrder(ctx context.Context, orderUID string) {
+	if !s.c.Delete(ctx, orderUID) {
+		return
+	}
+
+	// загрузка, начатая до изменения заказа, вернула бы старые данные - не присоединяемся к ней
+	s.loads.Forget(orderUID)
+	_, err, _ := s.loads.Do(orderUID, func() (any, error) {
+		return s.loadOrder(ctx, orderUID)
+	})
+	if err != nil {
+		s.log.Warn("Failed to refresh cached order", slog.String("order_uid", orderUID), slog.String("error", err.Error()))
+		return
+	}
+	s.log.Info("Refreshed cached order", slog.String("order_uid", orderUID))
+}
+
+func (s *Service) ValidateOrder(order *models.Order) error {
+	_, err := s.checkOrder(order)
+	return err
+}
+
+// checkOrder проверяет заказ тегами валидации и доменными правилами. Нарушения
+// правил с severity reject возвращаются ошибкой, остальные - предупреждениями.
+// Перед проверкой payment и payments приводятся к одному виду.
+func (s *Service) checkOrder(order *models.Order) ([]models.OrderWarning, error) {
+	order.NormalizePayments()
+
 	err := s.validator.Struct(order)
 	if err != nil {
 		s.log.Error("Error of validation order", slog.String("error", err.Error()), slog.String("order_uid", order.OrderUID))
-		return errorx.ErrOrderValidation
+		return nil, validationError(err)
+	}
+
+	var (
+		rejected []errorx.FieldError
+		warnings []models.OrderWarning
+	)
+	for _, v := range s.rules.Check(order) {
+		if v.Severity == rules.SeverityReject {
+			rejected = append(rejected, errorx.FieldError{Field: v.Field, Code: v.Code, Message: v.Message})
+			continue
+		}
+		warnings = append(warnings, models.OrderWarning{Code: v.Code, Field: v.Field, Message: v.Message})
+	}
+
+	if len(rejected) > 0 {
+		s.log.Error("Order violates domain rules", slog.String("order_uid", order.OrderUID), slog.Int("violations", len(rejected)))
+		return nil, &errorx.ValidationError{Fields: rejected}
+	}
+	if len(warnings) > 0 {
+		s.log.Warn("Order has domain warnings", slog.String("order_uid", order.OrderUID), slog.Int("warnings", len(warnings)))
+	}
+	return warnings, nil
+}
+
+func (s *Service) SaveOrder(ctx context.Context, order *models.Order) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.SaveOrder", trace.WithAttributes(attribute.String("order.uid", order.OrderUID)))
+	defer func() { finishSpan(span, err) }()
+	defer observeSave("SaveOrder", time.Now(), &err)
+
+	warnings, err := s.checkOrder(order)
+	if err != nil {
+		return err
 	}
+	order.Warnings = warnings
 
-	err = s.r.SaveOrder(order)
+	err = s.r.SaveOrder(ctx, order)
+	if isConflict(err) {
+		s.log.Warn("Order conflicts with stored data", slog.String("error", err.Error()))
+		return err
+	}
 	if err != nil {
 		s.log.Error("Failed to save order", slog.String("error", err.Error()))
 		return errorx.ErrInternal
 	}
 
-	s.c.SetOrder(*order)
+	s.c.SetOrder(ctx, *order)
 
 	return nil
 }
 
-func (s *Service) FillCache(size int) error {
-	orders, err := s.r.GetAllOrders(size)
-	if err != nil {
+// SaveOrders сохраняет пачку заказов одной транзакцией. Если хотя бы один заказ
+// не проходит валидацию, пачка не сохраняется.
+func (s *Service) SaveOrders(ctx context.Context, orders []*models.Order) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.SaveOrders", trace.WithAttributes(attribute.Int("orders.count", len(orders))))
+	defer func() { finishSpan(span, err) }()
+	defer observeSave("SaveOrders", time.Now(), &err)
+
+	for _, order := range orders {
+		warnings, err := s.checkOrder(order)
+		if err != nil {
+			return err
+		}
+		order.Warnings = warnings
+	}
+
+	err = s.r.SaveOrders(ctx, orders)
+	if isConflict(err) {
+		s.log.Warn("Orders batch conflicts with stored data", slog.String("error", err.Error()), slog.Int("size", len(orders)))
 		return err
 	}
+	if err != nil {
+		s.log.Error("Failed to save orders batch", slog.String("error", err.Error()), slog.Int("size", len(orders)))
+		return errorx.ErrInternal
+	}
 
 	for _, order := range orders {
-		s.c.SetOrder(order)
+		s.c.SetOrder(ctx, *order)
 	}
 
+	s.log.Info("Saved orders batch", slog.Int("size", len(orders)))
 	return nil
 }
+
+// ChangeOrderStatus переводит заказ в новый статус по графу переходов и возвращает
+// заказ после изменения
+func (s *Service) ChangeOrderStatus(ctx context.Context, orderUID string, update models.StatusUpdate) (_ *models.Order, err error) {
+	ctx, span := tracer.Start(ctx, "Service.ChangeOrderStatus", trace.WithAttributes(
+		attribute.String("order.uid", orderUID), attribute.String("order.status", string(update.Status))))
+	defer func() { finishSpan(span, err) }()
+
+	if !update.Status.Valid() {
+		return nil, &errorx.ValidationError{Fields: []errorx.FieldError{
+			{Field: "status", Message: fmt.Sprintf("unknown status %q", update.Status)},
+		}}
+	}
+
+	change := models.StatusChange{
+		OrderUID: orderUID,
+		To:       update.Status,
+		Source:   update.Source,
+		Reason:   update.Reason,
+	}
+	err = s.r.ChangeOrderStatus(ctx, &change, func(from models.OrderStatus) error {
+		if from == update.Status {
+			return errStatusUnchanged
+		}
+		if !from.CanTransitionTo(update.Status) {
+			return fmt.Errorf("%w: %s -> %s", errorx.ErrStatusTransition, from, update.Status)
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		s.c.Delete(ctx, orderUID)
+		s.log.Info("Order status changed", slog.String("order_uid", orderUID), slog.String("from", string(change.From)),
+			slog.String("to", string(change.To)), slog.String("source", change.Source))
+	case errors.Is(err, errStatusUnchanged):
+		s.log.Info("Order status unchanged", slog.String("order_uid", orderUID), slog.String("status", string(update.Status)))
+	case errors.Is(err, errorx.ErrOrderNotFound), errors.Is(err, errorx.ErrStatusTransition),
+		errors.Is(err, errorx.ErrVersionConflict):
+		s.log.Warn("Order status not changed", slog.String("order_uid", orderUID), slog.String("error", err.Error()))
+		return nil, err
+	default:
+		s.log.Error("Failed to change order status", slog.String("order_uid", orderUID), slog.String("error", err.Error()))
+		return nil, errorx.ErrInternal
+	}
+
+	return s.loadOrder(ctx, orderUID)
+}
+
+// GetOrderHistory возвращает версии заказа по возрастанию. У заказов, сохраненных
+// до появления версий, история пустая.
+func (s *Service) GetOrderHistory(ctx context.Context, orderUID string) ([]models.OrderVersion, error) {
+	versions, err := s.orderVersions(ctx, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	if versions == nil {
+		versions = []models.OrderVersion{}
+	}
+	return versions, nil
+}
+
+// DiffOrderVersions сравнивает две версии заказа. to = 0 - последняя версия,
+// from < 0 - версия перед to; версия 0 - пустой заказ до создания.
+func (s *Service) DiffOrderVersions(ctx context.Context, orderUID string, from, to int) (*models.OrderDiff, error) {
+	versions, err := s.orderVersions(ctx, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, errorx.ErrVersionNotFound
+	}
+
+	if to == 0 {
+		to = versions[len(versions)-1].Version
+	}
+	if from < 0 {
+		from = to - 1
+	}
+
+	snapshot := func(version int) ([]byte, error) {
+		if version == 0 {
+			return []byte("{}"), nil
+		}
+		for _, v := range versions {
+			if v.Version == version {
+				return v.Snapshot, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %d", errorx.ErrVersionNotFound, version)
+	}
+	fromSnapshot, err := snapshot(from)
+	if err != nil {
+		return nil, err
+	}
+	toSnapshot, err := snapshot(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := history.Diff(fromSnapshot, toSnapshot)
+	if err != nil {
+		s.log.Error("Failed to diff order versions", slog.String("order_uid", orderUID), slog.String("error", err.Error()))
+		return nil, errorx.ErrInternal
+	}
+	return &models.OrderDiff{OrderUID: orderUID, From: from, To: to, Changes: changes}, nil
+}
+
+func (s *Service) orderVersions(ctx context.Context, orderUID string) ([]models.OrderVersion, error) {
+	if _, err := s.GetOrderByUID(ctx, orderUID); err != nil {
+		return nil, err
+	}
+
+	versions, err := s.r.GetOrderVersions(ctx, orderUID)
+	if err != nil {
+		s.log.Error("Failed to get order versions", slog.String("order_uid", orderUID), slog.String("error", err.Error()))
+		return nil, errorx.ErrInternal
+	}
+	return versions, nil
+}
+
+func (s *Service) ListOrders(ctx context.Context, filter models.OrderFilter) (*models.OrderList, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+	limit := filter.Limit
+
+	// запрашиваем на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit++
+	orders, err := s.r.ListOrders(ctx, filter)
+	if err != nil {
+		s.log.Error("Failed to list orders", slog.String("error", err.Error()))
+		return nil, errorx.ErrInternal
+	}
+
+	list := &models.OrderList{Orders: orders}
+	if len(orders) > limit {
+		list.Orders = orders[:limit]
+		last := list.Orders[limit-1]
+		list.NextCursor = models.OrderCursor{DateCreated: last.DateCreated, OrderUID: last.OrderUID}.Encode()
+	}
+
+	return list, nil
+}
+
+// BeginIdempotentRequest резервирует ключ идемпотентности. Возвращает сохраненный
+// ответ, если запрос с таким ключом и телом уже был выполнен.
+func (s *Service) BeginIdempotentRequest(ctx context.Context, key, requestHash string) (*models.IdempotencyRecord, error) {
+	record, err := s.r.ReserveIdempotencyKey(ctx, key, requestHash)
+	if err != nil {
+		s.log.Error("Failed to reserve idempotency key", slog.String("error", err.Error()), slog.String("key", key))
+		return nil, errorx.ErrInternal
+	}
+	if record == nil {
+		return nil, nil
+	}
+
+	if record.RequestHash != requestHash {
+		s.log.Warn("Idempotency key reused with different request", slog.String("key", key))
+		return nil, errorx.ErrIdempotencyKeyReused
+	}
+	if record.StatusCode == 0 {
+		return nil, errorx.ErrIdempotencyKeyInProgress
+	}
+
+	s.log.Info("Replaying idempotent response", slog.String("key", key))
+	return record, nil
+}
+
+func (s *Service) CompleteIdempotentRequest(ctx context.Context, key string, statusCode int, headers map[string]string, body []byte) error {
+	var err error
+	// после ошибки сервера ключ освобождается, чтобы клиент мог повторить запрос
+	if statusCode >= 500 {
+		err = s.r.DeleteIdempotencyKey(ctx, key)
+	} else {
+		err = s.r.SaveIdempotentResponse(ctx, key, statusCode, headers, body)
+	}
+	if err != nil {
+		s.log.Error("Failed to complete idempotent request", slog.String("error", err.Error()), slog.String("key", key))
+		return errorx.ErrInternal
+	}
+	return nil
+}
+
+func (s *Service) FillCache(ctx context.Context, size int, strategy models.WarmStrategy) error {
+	orders, err := s.r.GetAllOrders(ctx, size, strategy)
+	if err != nil {
+		return err
+	}
+
+	// заказы идут от самого ценного, поэтому кладем с конца, чтобы ценные стали самыми свежими
+	for i := len(orders) - 1; i >= 0; i-- {
+		s.c.SetOrder(ctx, orders[i])
+	}
+
+	s.log.Info("Cache filled from db", slog.Int("orders", len(orders)), slog.String("strategy", string(strategy)))
+	return nil
+}
+
+// StartReadTracker включает учет чтений заказов и периодически сохраняет
+// время последнего чтения для стратегии прогрева recently_read
+func (s *Service) StartReadTracker(ctx context.Context, interval time.Duration) {
+	s.readsMu.Lock()
+	s.reads = make(map[string]struct{})
+	s.readsMu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx уже отменен, но накопленные чтения нужно успеть сохранить
+			s.FlushReads(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			s.FlushReads(ctx)
+		}
+	}
+}
+
+func (s *Service) FlushReads(ctx context.Context) {
+	s.readsMu.Lock()
+	if len(s.reads) == 0 {
+		s.readsMu.Unlock()
+		return
+	}
+	uids := make([]string, 0, len(s.reads))
+	for uid := range s.reads {
+		uids = append(uids, uid)
+	}
+	clear(s.reads)
+	s.readsMu.Unlock()
+
+	if err := s.r.TouchOrders(ctx, uids); err != nil {
+		s.log.Error("Failed to save order reads", slog.String("error", err.Error()), slog.Int("orders", len(uids)))
+	}
+}
+
+func (s *Service) recordRead(orderUID string) {
+	s.readsMu.Lock()
+	defer s.readsMu.Unlock()
+
+	if s.reads != nil {
+		s.reads[orderUID] = struct{}{}
+	}
+}
+
+func finishSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// isConflict - заказ расходится с уже сохраненными данными: товар или транзакция оплаты
+// принадлежат другому заказу либо заказ изменился после версии, на которой основан запрос
+func isConflict(err error) bool {
+	return errors.Is(err, errorx.ErrItemConflict) || errors.Is(err, errorx.ErrPaymentConflict) ||
+		errors.Is(err, errorx.ErrVersionConflict)
+}
+
+// observeSave записывает длительность сохранения с разбивкой по результату
+func observeSave(method string, start time.Time, err *error) {
+	outcome := metrics.OutcomeSuccess
+	switch {
+	case *err == nil:
+	case errors.Is(*err, errorx.ErrOrderValidation):
+		outcome = metrics.OutcomeValidationError
+	case isConflict(*err):
+		outcome = metrics.OutcomeConflict
+	default:
+		outcome = metrics.OutcomeInternalError
+	}
+	metrics.SaveDuration.WithLabelValues(method, outcome).Observe(time.Since(start).Seconds())
+}
+
+func validationError(err error) error {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return errorx.ErrOrderValidation
+	}
+
+	fields := make([]errorx.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		msg := "failed on '" + fe.Tag() + "'"
+		if fe.Param() != "" {
+			msg += " (" + fe.Param() + ")"
+		}
+		// отбрасываем имя корневой структуры: Order.payment.amount -> payment.amount
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		fields = append(fields, errorx.FieldError{Field: field, Message: msg})
+	}
+
+	return &errorx.ValidationError{Fields: fields}
+}
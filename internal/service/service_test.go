@@ -1,14 +1,17 @@
 package service_test
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"math/rand/v2"
 	"order-manager/internal/models"
+	"order-manager/internal/rules"
 	"order-manager/internal/service"
 	mocks "order-manager/mock"
 	"order-manager/pkg/errorx"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -32,11 +35,11 @@ func TestGetOrderByUID_FoundInCache(t *testing.T) {
 	repo := mocks.NewMockrepository(ctl)
 	cache := mocks.NewMockcache(ctl)
 
-	cache.EXPECT().GetOrder(in).Return(*orderIn, true)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(*orderIn, true)
 
 	service := service.NewService(repo, cache, logger)
 
-	_, err := service.GetOrderByUID(in)
+	_, err := service.GetOrderByUID(context.Background(), in)
 	require.NoError(t, err)
 }
 
@@ -52,12 +55,14 @@ func TestGetOrderByUID_FoundInDB(t *testing.T) {
 	repo := mocks.NewMockrepository(ctl)
 	cache := mocks.NewMockcache(ctl)
 
-	cache.EXPECT().GetOrder(in).Return(models.Order{}, false)
-	repo.EXPECT().GetOrderByUID(in).Return(orderIn, nil)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(models.Order{}, false)
+	cache.EXPECT().IsNotFound(gomock.Any(), in).Return(false)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), in).Return(orderIn, nil)
+	cache.EXPECT().SetOrder(gomock.Any(), *orderIn)
 
 	service := service.NewService(repo, cache, logger)
 
-	_, err := service.GetOrderByUID(in)
+	_, err := service.GetOrderByUID(context.Background(), in)
 	require.NoError(t, err)
 }
 
@@ -71,17 +76,209 @@ func TestGetOrderByUID_OrderNotFoundInDB(t *testing.T) {
 	in := orderIn.OrderUID
 
 	repo := mocks.NewMockrepository(ctl)
-	repo.EXPECT().GetOrderByUID(in).Return(nil, assert.AnError)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), in).Return(nil, assert.AnError)
 
 	cache := mocks.NewMockcache(ctl)
-	cache.EXPECT().GetOrder(in).Return(models.Order{}, false)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(models.Order{}, false)
+	cache.EXPECT().IsNotFound(gomock.Any(), in).Return(false)
 
 	service := service.NewService(repo, cache, logger)
-	_, err := service.GetOrderByUID(in)
+	_, err := service.GetOrderByUID(context.Background(), in)
 
 	require.ErrorIs(t, err, errorx.ErrInternal)
 }
 
+func TestGetOrderByUID_NotFoundIsCached(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	in := uuid.New().String()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), in).Return(nil, errorx.ErrOrderNotFound)
+
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(models.Order{}, false)
+	cache.EXPECT().IsNotFound(gomock.Any(), in).Return(false)
+	cache.EXPECT().SetNotFound(gomock.Any(), in)
+
+	service := service.NewService(repo, cache, logger)
+	_, err := service.GetOrderByUID(context.Background(), in)
+
+	require.ErrorIs(t, err, errorx.ErrOrderNotFound)
+}
+
+func TestGetOrderByUID_NegativeCacheHit(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	in := uuid.New().String()
+
+	repo := mocks.NewMockrepository(ctl)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(models.Order{}, false)
+	cache.EXPECT().IsNotFound(gomock.Any(), in).Return(true)
+
+	service := service.NewService(repo, cache, logger)
+	_, err := service.GetOrderByUID(context.Background(), in)
+
+	require.ErrorIs(t, err, errorx.ErrOrderNotFound)
+}
+
+func TestGetOrderByUID_ConcurrentMissesCollapsed(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	in := orderIn.OrderUID
+	const callers = 10
+
+	// загрузка из БД держится, пока все вызывающие не дойдут до нее после промаха по кэшу
+	var arrived sync.WaitGroup
+	arrived.Add(callers)
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), in).DoAndReturn(func(context.Context, string) (*models.Order, error) {
+		arrived.Wait()
+		return orderIn, nil
+	}).Times(1)
+
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(models.Order{}, false).Times(callers)
+	cache.EXPECT().IsNotFound(gomock.Any(), in).DoAndReturn(func(context.Context, string) bool {
+		arrived.Done()
+		return false
+	}).Times(callers)
+	cache.EXPECT().SetOrder(gomock.Any(), *orderIn)
+
+	service := service.NewService(repo, cache, logger)
+
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order, err := service.GetOrderByUID(context.Background(), in)
+			assert.NoError(t, err)
+			assert.Equal(t, in, order.OrderUID)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGetOrderByUID_CanceledWhileLoading(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	in := orderIn.OrderUID
+
+	release := make(chan struct{})
+	loaded := make(chan struct{})
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), in).DoAndReturn(func(ctx context.Context, _ string) (*models.Order, error) {
+		<-release
+		// загрузка не должна отменяться вместе с запросом, который ее начал
+		assert.NoError(t, ctx.Err())
+		return orderIn, nil
+	})
+
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), in).Return(models.Order{}, false)
+	cache.EXPECT().IsNotFound(gomock.Any(), in).Return(false)
+	cache.EXPECT().SetOrder(gomock.Any(), *orderIn).Do(func(context.Context, models.Order) {
+		close(loaded)
+	})
+
+	service := service.NewService(repo, cache, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := service.GetOrderByUID(ctx, in)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	<-loaded
+}
+
+func TestRefreshOrder_ReloadsCachedOrder(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	in := orderIn.OrderUID
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), in).Return(orderIn, nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().Delete(gomock.Any(), in).Return(true)
+	cache.EXPECT().SetOrder(gomock.Any(), *orderIn)
+
+	service := service.NewService(repo, cache, logger)
+	service.RefreshOrder(context.Background(), in)
+}
+
+func TestRefreshOrder_SkipsUncachedOrder(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	repo := mocks.NewMockrepository(ctl)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().Delete(gomock.Any(), "missing").Return(false)
+
+	service := service.NewService(repo, cache, logger)
+	service.RefreshOrder(context.Background(), "missing")
+}
+
+func TestReconcileCache_DropsStaleOrders(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().Versions().Return(map[string]int{"fresh": 2, "stale": 2, "deleted": 1})
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetCurrentVersions(gomock.Any(), gomock.InAnyOrder([]string{"fresh", "stale", "deleted"})).
+		Return(map[string]int{"fresh": 2, "stale": 3}, nil)
+	cache.EXPECT().Delete(gomock.Any(), "stale").Return(true)
+	cache.EXPECT().Delete(gomock.Any(), "deleted").Return(true)
+
+	service := service.NewService(repo, cache, logger)
+	stale, err := service.ReconcileCache(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, stale)
+}
+
+func TestReconcileCache_DbError(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().Versions().Return(map[string]int{"a": 1})
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetCurrentVersions(gomock.Any(), []string{"a"}).Return(nil, assert.AnError)
+
+	service := service.NewService(repo, cache, logger)
+	_, err := service.ReconcileCache(context.Background())
+
+	require.ErrorIs(t, err, assert.AnError)
+}
+
 func TestSaveOrder_Success(t *testing.T) {
 	t.Parallel()
 
@@ -91,12 +288,12 @@ func TestSaveOrder_Success(t *testing.T) {
 	orderIn := MakeRandomOrder()
 
 	repo := mocks.NewMockrepository(ctl)
-	repo.EXPECT().SaveOrder(orderIn).Return(nil)
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).Return(nil)
 	cache := mocks.NewMockcache(ctl)
-	cache.EXPECT().SetOrder(*orderIn)
+	cache.EXPECT().SetOrder(gomock.Any(), *orderIn)
 
 	service := service.NewService(repo, cache, logger)
-	err := service.SaveOrder(orderIn)
+	err := service.SaveOrder(context.Background(), orderIn)
 
 	require.NoError(t, err)
 }
@@ -109,14 +306,63 @@ func TestSaveOrder_OrderValidationError(t *testing.T) {
 
 	orderIn := MakeRandomOrder()
 	orderIn.Payment.DeliveryCost = -100
+	orderIn.Payments = nil
 
 	repo := mocks.NewMockrepository(ctl)
 	cache := mocks.NewMockcache(ctl)
 
 	service := service.NewService(repo, cache, logger)
-	err := service.SaveOrder(orderIn)
+	err := service.SaveOrder(context.Background(), orderIn)
 
 	require.ErrorIs(t, err, errorx.ErrOrderValidation)
+
+	var verr *errorx.ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Fields, errorx.FieldError{Field: "payment.delivery_cost", Message: "failed on 'gte' (0)"})
+}
+
+func TestSaveOrder_DomainRuleRejected(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	orderIn.Payments[0].Amount++
+
+	service := service.NewService(mocks.NewMockrepository(ctl), mocks.NewMockcache(ctl), logger)
+	err := service.SaveOrder(context.Background(), orderIn)
+
+	var verr *errorx.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Fields, 1)
+	assert.Equal(t, "payment.amount", verr.Fields[0].Field)
+	assert.Equal(t, rules.CodeAmountMismatch, verr.Fields[0].Code)
+}
+
+func TestSaveOrder_WarningsPersisted(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	orderIn.Item[0].TrackNumber = "OTHER"
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).DoAndReturn(func(_ context.Context, order *models.Order) error {
+		require.Len(t, order.Warnings, 1)
+		assert.Equal(t, rules.CodeItemTrackMismatch, order.Warnings[0].Code)
+		assert.Equal(t, "items[0].track_number", order.Warnings[0].Field)
+		return nil
+	})
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().SetOrder(gomock.Any(), gomock.Any())
+
+	service := service.NewService(repo, cache, logger)
+	err := service.SaveOrder(context.Background(), orderIn)
+
+	require.NoError(t, err)
 }
 
 func TestSaveOrder_DBError(t *testing.T) {
@@ -128,42 +374,285 @@ func TestSaveOrder_DBError(t *testing.T) {
 	orderIn := MakeRandomOrder()
 
 	repo := mocks.NewMockrepository(ctl)
-	repo.EXPECT().SaveOrder(orderIn).Return(fmt.Errorf("Error from repository"))
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).Return(fmt.Errorf("Error from repository"))
 	cache := mocks.NewMockcache(ctl)
 
 	service := service.NewService(repo, cache, logger)
 
-	err := service.SaveOrder(orderIn)
+	err := service.SaveOrder(context.Background(), orderIn)
 
 	require.ErrorIs(t, err, errorx.ErrInternal)
 }
 
+func TestSaveOrder_LegacyPaymentNormalized(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	orderIn.Payment.Type = ""
+	orderIn.Payments = nil
+	orderIn.NetPaid = 0
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).Return(nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().SetOrder(gomock.Any(), gomock.Any())
+
+	service := service.NewService(repo, cache, logger)
+	err := service.SaveOrder(context.Background(), orderIn)
+
+	require.NoError(t, err)
+	require.Len(t, orderIn.Payments, 1)
+	assert.Equal(t, models.PaymentCharge, orderIn.Payments[0].Type)
+	assert.Equal(t, orderIn.Payment, orderIn.Payments[0])
+	assert.Equal(t, orderIn.Payment.Amount, orderIn.NetPaid)
+}
+
+func TestSaveOrder_PaymentsWithRefund(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	charge := orderIn.Payment
+	refund := models.Payment{
+		Transaction: uuid.New().String(),
+		Type:        models.PaymentRefund,
+		Currency:    charge.Currency,
+		Provider:    charge.Provider,
+		Amount:      charge.Amount / 2,
+		PaymentDt:   charge.PaymentDt + 1,
+		Bank:        charge.Bank,
+	}
+	orderIn.Payment = models.Payment{}
+	orderIn.Payments = []models.Payment{refund, charge}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).Return(nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().SetOrder(gomock.Any(), gomock.Any())
+
+	service := service.NewService(repo, cache, logger)
+	err := service.SaveOrder(context.Background(), orderIn)
+
+	require.NoError(t, err)
+	assert.Equal(t, charge, orderIn.Payment)
+	assert.Equal(t, charge.Amount-refund.Amount, orderIn.NetPaid)
+}
+
+func TestSaveOrder_RefundExceedsPaid(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	refund := orderIn.Payment
+	refund.Transaction = uuid.New().String()
+	refund.Type = models.PaymentChargeback
+	refund.Amount++
+	orderIn.Payments = append(orderIn.Payments, refund)
+
+	service := service.NewService(mocks.NewMockrepository(ctl), mocks.NewMockcache(ctl), logger)
+	err := service.SaveOrder(context.Background(), orderIn)
+
+	var verr *errorx.ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Fields, 1)
+	assert.Equal(t, rules.CodeRefundExceedsPaid, verr.Fields[0].Code)
+}
+
+func TestSaveOrder_ItemConflict(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).Return(fmt.Errorf("%w: rid %s", errorx.ErrItemConflict, orderIn.Item[0].Rid))
+	cache := mocks.NewMockcache(ctl)
+
+	service := service.NewService(repo, cache, logger)
+
+	err := service.SaveOrder(context.Background(), orderIn)
+
+	require.ErrorIs(t, err, errorx.ErrItemConflict)
+	assert.NotErrorIs(t, err, errorx.ErrInternal)
+}
+
+func TestSaveOrders_Success(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orders := []*models.Order{MakeRandomOrder(), MakeRandomOrder()}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().SaveOrders(gomock.Any(), orders).Return(nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().SetOrder(gomock.Any(), *orders[0])
+	cache.EXPECT().SetOrder(gomock.Any(), *orders[1])
+
+	service := service.NewService(repo, cache, logger)
+	err := service.SaveOrders(context.Background(), orders)
+
+	require.NoError(t, err)
+}
+
+func TestSaveOrders_OneInvalid(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	invalid := MakeRandomOrder()
+	invalid.OrderUID = ""
+	orders := []*models.Order{MakeRandomOrder(), invalid}
+
+	repo := mocks.NewMockrepository(ctl)
+	cache := mocks.NewMockcache(ctl)
+
+	service := service.NewService(repo, cache, logger)
+	err := service.SaveOrders(context.Background(), orders)
+
+	require.ErrorIs(t, err, errorx.ErrOrderValidation)
+}
+
+func TestFillCache_NewestLastInserted(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	newest, older := MakeRandomOrder(), MakeRandomOrder()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetAllOrders(gomock.Any(), 2, models.WarmNewest).Return([]models.Order{*newest, *older}, nil)
+	cache := mocks.NewMockcache(ctl)
+	gomock.InOrder(
+		cache.EXPECT().SetOrder(gomock.Any(), *older),
+		cache.EXPECT().SetOrder(gomock.Any(), *newest),
+	)
+
+	service := service.NewService(repo, cache, logger)
+	err := service.FillCache(context.Background(), 2, models.WarmNewest)
+
+	require.NoError(t, err)
+}
+
+func TestListOrders_NextCursor(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orders := []models.Order{*MakeRandomOrder(), *MakeRandomOrder(), *MakeRandomOrder()}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ListOrders(gomock.Any(), models.OrderFilter{CustomerID: "c1", Limit: 3}).Return(orders, nil)
+	cache := mocks.NewMockcache(ctl)
+
+	service := service.NewService(repo, cache, logger)
+	list, err := service.ListOrders(context.Background(), models.OrderFilter{CustomerID: "c1", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, list.Orders, 2)
+
+	cursor, err := models.DecodeCursor(list.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, orders[1].OrderUID, cursor.OrderUID)
+	assert.True(t, orders[1].DateCreated.Equal(cursor.DateCreated))
+}
+
+func TestListOrders_LastPage(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orders := []models.Order{*MakeRandomOrder()}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ListOrders(gomock.Any(), models.OrderFilter{Limit: 21}).Return(orders, nil)
+	cache := mocks.NewMockcache(ctl)
+
+	service := service.NewService(repo, cache, logger)
+	list, err := service.ListOrders(context.Background(), models.OrderFilter{})
+	require.NoError(t, err)
+	require.Len(t, list.Orders, 1)
+	assert.Empty(t, list.NextCursor)
+}
+
+func TestBeginIdempotentRequest_Replay(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	record := &models.IdempotencyRecord{Key: "key", RequestHash: "hash", StatusCode: 201, Body: []byte("{}")}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ReserveIdempotencyKey(gomock.Any(), "key", "hash").Return(record, nil)
+	cache := mocks.NewMockcache(ctl)
+
+	service := service.NewService(repo, cache, logger)
+	got, err := service.BeginIdempotentRequest(context.Background(), "key", "hash")
+
+	require.NoError(t, err)
+	assert.Equal(t, record, got)
+}
+
+func TestBeginIdempotentRequest_DifferentBody(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	record := &models.IdempotencyRecord{Key: "key", RequestHash: "hash", StatusCode: 201}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ReserveIdempotencyKey(gomock.Any(), "key", "other").Return(record, nil)
+	cache := mocks.NewMockcache(ctl)
+
+	service := service.NewService(repo, cache, logger)
+	_, err := service.BeginIdempotentRequest(context.Background(), "key", "other")
+
+	require.ErrorIs(t, err, errorx.ErrIdempotencyKeyReused)
+}
+
 func MakeRandomOrder() *models.Order {
 	item := models.Item{
 		ChrtID:      1000000 + rand.IntN(100000),
 		TrackNumber: "WBTESTTRACK",
-		Price:       1 + rand.IntN(1000),
+		Price:       100 + rand.IntN(1000),
 		Rid:         uuid.New().String(),
 		NameItem:    "Test Name Item",
-		Sale:        rand.IntN(100),
+		Sale:        rand.IntN(50),
 		Size:        0,
-		TotalPrice:  rand.IntN(10000),
 		NmID:        0,
 		Brand:       "Test Brand",
 		Status:      202,
 	}
+	// суммы согласованы так, чтобы заказ проходил доменные правила
+	item.TotalPrice = item.Price * (100 - item.Sale) / 100
 	payment := models.Payment{
 		Transaction:  uuid.New().String(),
+		Type:         models.PaymentCharge,
 		RequestID:    "",
 		Currency:     "USD",
 		Provider:     "wbpay",
-		Amount:       rand.IntN(100),
 		PaymentDt:    1000000 + rand.IntN(100000),
 		Bank:         "test bank",
-		DeliveryCost: rand.IntN(1000),
-		GoodsTotal:   rand.IntN(10000),
+		DeliveryCost: 1 + rand.IntN(1000),
 		CustomFee:    0,
 	}
+	payment.GoodsTotal = item.TotalPrice
+	payment.Amount = payment.GoodsTotal + payment.DeliveryCost + payment.CustomFee
 	delivery := models.Delivery{
 		Name:    "Test Testov",
 		Phone:   "+79000000000",
@@ -175,19 +664,255 @@ func MakeRandomOrder() *models.Order {
 	}
 	order := models.Order{
 		OrderUID:          uuid.New().String(),
-		TrackNumber:       "new",
+		TrackNumber:       "WBTESTTRACK",
 		Entry:             "WBIL",
 		Locate:            "en",
 		InternalSignature: " ",
 		CustomerID:        uuid.New().String(),
 		DeliveryService:   "meest",
 		Shardkey:          "0",
-		SmID:              rand.IntN(100),
+		SmID:              1 + rand.IntN(100),
 		DateCreated:       time.Now().UTC(),
 		OffShard:          "1",
 		Delivery:          delivery,
 		Payment:           payment,
+		Payments:          []models.Payment{payment},
+		NetPaid:           payment.Amount,
 		Item:              []models.Item{item},
 	}
 	return &order
 }
+
+// changeStatusFrom имитирует репозиторий, в котором заказ находится в статусе from
+func changeStatusFrom(from models.OrderStatus) func(context.Context, *models.StatusChange, func(models.OrderStatus) error) error {
+	return func(_ context.Context, change *models.StatusChange, check func(models.OrderStatus) error) error {
+		change.From = from
+		if err := check(from); err != nil {
+			return err
+		}
+		change.ChangedAt = time.Now()
+		return nil
+	}
+}
+
+func TestChangeOrderStatus_Success(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	order := MakeRandomOrder()
+	order.Status = models.StatusPaid
+	update := models.StatusUpdate{Status: models.StatusPaid, Source: models.SourceHTTP, Reason: "payment captured"}
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ChangeOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, change *models.StatusChange, check func(models.OrderStatus) error) error {
+			assert.Equal(t, order.OrderUID, change.OrderUID)
+			assert.Equal(t, models.StatusPaid, change.To)
+			assert.Equal(t, update.Source, change.Source)
+			assert.Equal(t, update.Reason, change.Reason)
+			return changeStatusFrom(models.StatusCreated)(ctx, change, check)
+		})
+	repo.EXPECT().GetOrderByUID(gomock.Any(), order.OrderUID).Return(order, nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().Delete(gomock.Any(), order.OrderUID).Return(true)
+	cache.EXPECT().SetOrder(gomock.Any(), *order)
+
+	service := service.NewService(repo, cache, logger)
+	out, err := service.ChangeOrderStatus(context.Background(), order.OrderUID, update)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPaid, out.Status)
+}
+
+func TestChangeOrderStatus_TransitionNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		from, to models.OrderStatus
+	}{
+		{models.StatusCreated, models.StatusShipped},
+		{models.StatusDelivered, models.StatusCancelled},
+		{models.StatusCancelled, models.StatusPaid},
+		{models.StatusReturned, models.StatusDelivered},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.from)+"->"+string(tc.to), func(t *testing.T) {
+			t.Parallel()
+
+			ctl := gomock.NewController(t)
+			defer ctl.Finish()
+
+			repo := mocks.NewMockrepository(ctl)
+			repo.EXPECT().ChangeOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(changeStatusFrom(tc.from))
+
+			service := service.NewService(repo, mocks.NewMockcache(ctl), logger)
+			_, err := service.ChangeOrderStatus(context.Background(), "uid", models.StatusUpdate{Status: tc.to})
+
+			require.ErrorIs(t, err, errorx.ErrStatusTransition)
+		})
+	}
+}
+
+func TestChangeOrderStatus_Unchanged(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	order := MakeRandomOrder()
+	order.Status = models.StatusShipped
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ChangeOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(changeStatusFrom(models.StatusShipped))
+	repo.EXPECT().GetOrderByUID(gomock.Any(), order.OrderUID).Return(order, nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().SetOrder(gomock.Any(), *order)
+
+	service := service.NewService(repo, cache, logger)
+	out, err := service.ChangeOrderStatus(context.Background(), order.OrderUID, models.StatusUpdate{Status: models.StatusShipped})
+
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusShipped, out.Status)
+}
+
+func TestChangeOrderStatus_UnknownStatus(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	service := service.NewService(mocks.NewMockrepository(ctl), mocks.NewMockcache(ctl), logger)
+	_, err := service.ChangeOrderStatus(context.Background(), "uid", models.StatusUpdate{Status: "lost"})
+
+	var verr *errorx.ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, "status", verr.Fields[0].Field)
+}
+
+func TestChangeOrderStatus_NotFound(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ChangeOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).Return(errorx.ErrOrderNotFound)
+
+	service := service.NewService(repo, mocks.NewMockcache(ctl), logger)
+	_, err := service.ChangeOrderStatus(context.Background(), "uid", models.StatusUpdate{Status: models.StatusPaid})
+
+	require.ErrorIs(t, err, errorx.ErrOrderNotFound)
+}
+
+func makeVersions(orderUID string, snapshots ...string) []models.OrderVersion {
+	versions := make([]models.OrderVersion, len(snapshots))
+	for i, snapshot := range snapshots {
+		versions[i] = models.OrderVersion{
+			OrderUID: orderUID,
+			Version:  i + 1,
+			Source:   models.SourceKafka,
+			Snapshot: []byte(snapshot),
+		}
+	}
+	return versions
+}
+
+func TestDiffOrderVersions_DefaultsToLatestPair(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	order := MakeRandomOrder()
+	versions := makeVersions(order.OrderUID, `{"status": "created"}`, `{"status": "paid"}`, `{"status": "shipped"}`)
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderVersions(gomock.Any(), order.OrderUID).Return(versions, nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), order.OrderUID).Return(*order, true)
+
+	service := service.NewService(repo, cache, logger)
+	diff, err := service.DiffOrderVersions(context.Background(), order.OrderUID, -1, 0)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, diff.From)
+	assert.Equal(t, 3, diff.To)
+	assert.Equal(t, []models.FieldChange{{Path: "status", Op: models.DiffChanged, Old: "paid", New: "shipped"}}, diff.Changes)
+}
+
+func TestDiffOrderVersions_VersionNotFound(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	order := MakeRandomOrder()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderVersions(gomock.Any(), order.OrderUID).Return(makeVersions(order.OrderUID, `{}`), nil)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), order.OrderUID).Return(*order, true)
+
+	service := service.NewService(repo, cache, logger)
+	_, err := service.DiffOrderVersions(context.Background(), order.OrderUID, 1, 5)
+
+	require.ErrorIs(t, err, errorx.ErrVersionNotFound)
+}
+
+func TestGetOrderHistory_OrderNotFound(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().GetOrderByUID(gomock.Any(), "missing").Return(nil, errorx.ErrOrderNotFound)
+	cache := mocks.NewMockcache(ctl)
+	cache.EXPECT().GetOrder(gomock.Any(), "missing").Return(models.Order{}, false)
+	cache.EXPECT().IsNotFound(gomock.Any(), "missing").Return(false)
+	cache.EXPECT().SetNotFound(gomock.Any(), "missing")
+
+	service := service.NewService(repo, cache, logger)
+	_, err := service.GetOrderHistory(context.Background(), "missing")
+
+	require.ErrorIs(t, err, errorx.ErrOrderNotFound)
+}
+
+func TestSaveOrder_VersionConflict(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	orderIn := MakeRandomOrder()
+	ctx := models.WithChangeSource(context.Background(), models.ChangeSource{Kind: models.SourceHTTP, ExpectedVersion: 3})
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().SaveOrder(gomock.Any(), orderIn).DoAndReturn(func(ctx context.Context, order *models.Order) error {
+		src := models.ChangeSourceFrom(ctx, 0)
+		require.Equal(t, 3, src.ExpectedVersion)
+		return fmt.Errorf("%w: order %s, expected version %d", errorx.ErrVersionConflict, order.OrderUID, src.ExpectedVersion)
+	})
+
+	service := service.NewService(repo, mocks.NewMockcache(ctl), logger)
+	err := service.SaveOrder(ctx, orderIn)
+
+	require.ErrorIs(t, err, errorx.ErrVersionConflict)
+}
+
+func TestChangeOrderStatus_VersionConflict(t *testing.T) {
+	t.Parallel()
+
+	ctl := gomock.NewController(t)
+	defer ctl.Finish()
+
+	repo := mocks.NewMockrepository(ctl)
+	repo.EXPECT().ChangeOrderStatus(gomock.Any(), gomock.Any(), gomock.Any()).Return(errorx.ErrVersionConflict)
+
+	service := service.NewService(repo, mocks.NewMockcache(ctl), logger)
+	_, err := service.ChangeOrderStatus(context.Background(), "uid", models.StatusUpdate{Status: models.StatusPaid})
+
+	require.ErrorIs(t, err, errorx.ErrVersionConflict)
+}
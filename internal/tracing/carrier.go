@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaCarrier передает контекст трассировки через заголовки сообщения Kafka
+type KafkaCarrier struct {
+	Headers *[]kafka.Header
+}
+
+func (c KafkaCarrier) Get(key string) string {
+	for _, h := range *c.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c KafkaCarrier) Set(key, value string) {
+	for i, h := range *c.Headers {
+		if h.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c KafkaCarrier) Keys() []string {
+	keys := make([]string, len(*c.Headers))
+	for i, h := range *c.Headers {
+		keys[i] = h.Key
+	}
+	return keys
+}
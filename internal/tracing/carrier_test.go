@@ -0,0 +1,35 @@
+package tracing_test
+
+import (
+	"context"
+	"order-manager/internal/tracing"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestKafkaCarrier_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1, 2, 3},
+		SpanID:     trace.SpanID{4, 5, 6},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	headers := []kafka.Header{{Key: "x-source", Value: []byte("producer")}}
+	propagator := propagation.TraceContext{}
+	propagator.Inject(ctx, tracing.KafkaCarrier{Headers: &headers})
+	// повторная запись не должна дублировать заголовок
+	propagator.Inject(ctx, tracing.KafkaCarrier{Headers: &headers})
+	assert.Len(t, headers, 2)
+
+	got := trace.SpanContextFromContext(propagator.Extract(context.Background(), tracing.KafkaCarrier{Headers: &headers}))
+	assert.Equal(t, sc.TraceID(), got.TraceID())
+	assert.Equal(t, sc.SpanID(), got.SpanID())
+	assert.True(t, got.IsRemote())
+}
@@ -0,0 +1,61 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"order-manager/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Init настраивает глобальный TracerProvider и W3C-пропагацию контекста.
+// Возвращает функцию, которая выгружает накопленные спаны при остановке.
+// Адрес коллектора OTLP берется из стандартной OTEL_EXPORTER_OTLP_ENDPOINT.
+func Init(ctx context.Context, cfg config.Tracing, instanceID string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s trace exporter - %w", cfg.Exporter, err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceInstanceID(instanceID),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
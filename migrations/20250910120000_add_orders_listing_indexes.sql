@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS orders_date_created_order_uid_idx ON orders (date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS orders_customer_id_idx ON orders (customer_id, date_created DESC, order_uid DESC);
+CREATE INDEX IF NOT EXISTS orders_track_number_idx ON orders (track_number);
+CREATE INDEX IF NOT EXISTS items_order_uid_idx ON items (order_uid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS items_order_uid_idx;
+DROP INDEX IF EXISTS orders_track_number_idx;
+DROP INDEX IF EXISTS orders_customer_id_idx;
+DROP INDEX IF EXISTS orders_date_created_order_uid_idx;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS last_read_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS orders_last_read_at_idx ON orders (last_read_at DESC NULLS LAST);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS orders_last_read_at_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS last_read_at;
+-- +goose StatementEnd
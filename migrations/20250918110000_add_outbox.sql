@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    headers JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_delivered_at_idx ON outbox (delivered_at) WHERE delivered_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outbox;
+-- +goose StatementEnd
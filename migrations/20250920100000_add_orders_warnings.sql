@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS warnings JSONB NOT NULL DEFAULT '[]';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE orders DROP COLUMN IF EXISTS warnings;
+-- +goose StatementEnd
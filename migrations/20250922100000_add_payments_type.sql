@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS type VARCHAR(32) NOT NULL DEFAULT 'charge';
+CREATE INDEX IF NOT EXISTS payments_order_uid_idx ON payments (order_uid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS payments_order_uid_idx;
+ALTER TABLE payments DROP COLUMN IF EXISTS type;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'created';
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    from_status VARCHAR(32) NOT NULL,
+    to_status VARCHAR(32) NOT NULL,
+    source VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_at TIMESTAMP NOT NULL DEFAULT now(),
+    FOREIGN KEY (order_uid) REFERENCES orders (order_uid) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_uid_idx ON order_status_history (order_uid, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_status_history;
+ALTER TABLE orders DROP COLUMN IF EXISTS status;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS order_versions (
+    order_uid VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    source VARCHAR(255) NOT NULL,
+    source_ref VARCHAR(255) NOT NULL DEFAULT '',
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (order_uid, version),
+    FOREIGN KEY (order_uid) REFERENCES orders (order_uid) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS order_versions;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- версия заказа совпадает с номером последней записи в order_versions
+UPDATE orders o
+SET version = v.version
+FROM (
+    SELECT order_uid, MAX(version) AS version FROM order_versions GROUP BY order_uid
+) v
+WHERE v.order_uid = o.order_uid;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE orders DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+-- заказы, сохраненные до появления order_versions, получают снимок текущего состояния:
+-- смена статуса строит новую версию и событие outbox из последнего снимка
+INSERT INTO order_versions (order_uid, version, source, snapshot)
+SELECT
+    o.order_uid, o.version, 'migration',
+    jsonb_strip_nulls(jsonb_build_object(
+        'order_uid', o.order_uid,
+        'track_number', o.track_number,
+        'entry', o.entry,
+        'delivery', jsonb_build_object(
+            'name', d.name, 'phone', d.phone, 'zip', d.zip, 'city', d.city,
+            'address', d.address, 'region', d.region, 'email', d.email
+        ),
+        'payment', COALESCE(p.primary_payment, '{}'::jsonb),
+        'payments', p.list,
+        'net_paid', COALESCE(p.net_paid, 0),
+        'items', COALESCE(i.list, '[]'::jsonb),
+        'locale', o.locate,
+        'internal_signature', o.internal_signature,
+        'customer_id', o.customer_id,
+        'delivery_service', o.delivery_service,
+        'shardkey', o.shardkey,
+        'sm_id', o.sm_id,
+        'date_created', to_char(o.date_created, 'YYYY-MM-DD"T"HH24:MI:SS"Z"'),
+        'oof_shard', o.off_shard,
+        'status', o.status,
+        'version', o.version,
+        'warnings', NULLIF(o.warnings, '[]'::jsonb)
+    ))
+FROM
+    orders o
+    LEFT JOIN deliveries d ON d.order_uid = o.order_uid
+    LEFT JOIN LATERAL (
+        SELECT
+            jsonb_agg(pj ORDER BY pay.payment_dt, pay.transaction) AS list,
+            -- основная оплата - первое списание, как в NormalizePayments
+            (array_agg(pj ORDER BY pay.type <> 'charge', pay.payment_dt, pay.transaction))[1] AS primary_payment,
+            SUM(CASE
+                WHEN pay.type IN ('charge', 'capture') THEN pay.amount
+                WHEN pay.type IN ('refund', 'chargeback') THEN -pay.amount
+                ELSE 0
+            END) AS net_paid
+        FROM
+            payments pay,
+            LATERAL jsonb_build_object(
+                'transaction', pay.transaction, 'type', pay.type, 'request_id', COALESCE(pay.request_id, ''),
+                'currency', pay.currency, 'provider', pay.provider, 'amount', pay.amount,
+                'payment_dt', pay.payment_dt, 'bank', pay.bank, 'delivery_cost', pay.delivery_cost,
+                'goods_total', pay.goods_total, 'custom_fee', pay.custom_fee
+            ) AS pj
+        WHERE
+            pay.order_uid = o.order_uid
+    ) p ON true
+    LEFT JOIN LATERAL (
+        SELECT
+            jsonb_agg(jsonb_build_object(
+                'chrt_id', it.chrt_id, 'track_number', it.track_number, 'price', it.price, 'rid', it.rid,
+                'name', it.name_item, 'sale', it.sale, 'size', it.size, 'total_price', it.total_price,
+                'nm_id', it.nm_id, 'brand', it.brand, 'status', it.status
+            ) ORDER BY it.id) AS list
+        FROM
+            items it
+        WHERE
+            it.order_uid = o.order_uid
+    ) i ON true
+WHERE
+    NOT EXISTS (SELECT 1 FROM order_versions v WHERE v.order_uid = o.order_uid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM order_versions WHERE source = 'migration';
+-- +goose StatementEnd
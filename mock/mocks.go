@@ -10,6 +10,7 @@
 package mocks
 
 import (
+	context "context"
 	models "order-manager/internal/models"
 	reflect "reflect"
 
@@ -40,48 +41,178 @@ func (m *Mockrepository) EXPECT() *MockrepositoryMockRecorder {
 	return m.recorder
 }
 
+// ChangeOrderStatus mocks base method.
+func (m *Mockrepository) ChangeOrderStatus(arg0 context.Context, arg1 *models.StatusChange, arg2 func(models.OrderStatus) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangeOrderStatus", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangeOrderStatus indicates an expected call of ChangeOrderStatus.
+func (mr *MockrepositoryMockRecorder) ChangeOrderStatus(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeOrderStatus", reflect.TypeOf((*Mockrepository)(nil).ChangeOrderStatus), arg0, arg1, arg2)
+}
+
+// DeleteIdempotencyKey mocks base method.
+func (m *Mockrepository) DeleteIdempotencyKey(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteIdempotencyKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteIdempotencyKey indicates an expected call of DeleteIdempotencyKey.
+func (mr *MockrepositoryMockRecorder) DeleteIdempotencyKey(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteIdempotencyKey", reflect.TypeOf((*Mockrepository)(nil).DeleteIdempotencyKey), arg0, arg1)
+}
+
 // GetAllOrders mocks base method.
-func (m *Mockrepository) GetAllOrders(arg0 int) ([]models.Order, error) {
+func (m *Mockrepository) GetAllOrders(arg0 context.Context, arg1 int, arg2 models.WarmStrategy) ([]models.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllOrders", arg0)
+	ret := m.ctrl.Call(m, "GetAllOrders", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]models.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAllOrders indicates an expected call of GetAllOrders.
-func (mr *MockrepositoryMockRecorder) GetAllOrders(arg0 any) *gomock.Call {
+func (mr *MockrepositoryMockRecorder) GetAllOrders(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllOrders", reflect.TypeOf((*Mockrepository)(nil).GetAllOrders), arg0, arg1, arg2)
+}
+
+// GetCurrentVersions mocks base method.
+func (m *Mockrepository) GetCurrentVersions(arg0 context.Context, arg1 []string) (map[string]int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCurrentVersions", arg0, arg1)
+	ret0, _ := ret[0].(map[string]int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCurrentVersions indicates an expected call of GetCurrentVersions.
+func (mr *MockrepositoryMockRecorder) GetCurrentVersions(arg0, arg1 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllOrders", reflect.TypeOf((*Mockrepository)(nil).GetAllOrders), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentVersions", reflect.TypeOf((*Mockrepository)(nil).GetCurrentVersions), arg0, arg1)
 }
 
 // GetOrderByUID mocks base method.
-func (m *Mockrepository) GetOrderByUID(arg0 string) (*models.Order, error) {
+func (m *Mockrepository) GetOrderByUID(arg0 context.Context, arg1 string) (*models.Order, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrderByUID", arg0)
+	ret := m.ctrl.Call(m, "GetOrderByUID", arg0, arg1)
 	ret0, _ := ret[0].(*models.Order)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetOrderByUID indicates an expected call of GetOrderByUID.
-func (mr *MockrepositoryMockRecorder) GetOrderByUID(arg0 any) *gomock.Call {
+func (mr *MockrepositoryMockRecorder) GetOrderByUID(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderByUID", reflect.TypeOf((*Mockrepository)(nil).GetOrderByUID), arg0, arg1)
+}
+
+// GetOrderVersions mocks base method.
+func (m *Mockrepository) GetOrderVersions(arg0 context.Context, arg1 string) ([]models.OrderVersion, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderVersions", arg0, arg1)
+	ret0, _ := ret[0].([]models.OrderVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderVersions indicates an expected call of GetOrderVersions.
+func (mr *MockrepositoryMockRecorder) GetOrderVersions(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderVersions", reflect.TypeOf((*Mockrepository)(nil).GetOrderVersions), arg0, arg1)
+}
+
+// ListOrders mocks base method.
+func (m *Mockrepository) ListOrders(arg0 context.Context, arg1 models.OrderFilter) ([]models.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOrders", arg0, arg1)
+	ret0, _ := ret[0].([]models.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOrders indicates an expected call of ListOrders.
+func (mr *MockrepositoryMockRecorder) ListOrders(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOrders", reflect.TypeOf((*Mockrepository)(nil).ListOrders), arg0, arg1)
+}
+
+// ReserveIdempotencyKey mocks base method.
+func (m *Mockrepository) ReserveIdempotencyKey(arg0 context.Context, arg1, arg2 string) (*models.IdempotencyRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveIdempotencyKey", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*models.IdempotencyRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReserveIdempotencyKey indicates an expected call of ReserveIdempotencyKey.
+func (mr *MockrepositoryMockRecorder) ReserveIdempotencyKey(arg0, arg1, arg2 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveIdempotencyKey", reflect.TypeOf((*Mockrepository)(nil).ReserveIdempotencyKey), arg0, arg1, arg2)
+}
+
+// SaveIdempotentResponse mocks base method.
+func (m *Mockrepository) SaveIdempotentResponse(arg0 context.Context, arg1 string, arg2 int, arg3 map[string]string, arg4 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotentResponse", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotentResponse indicates an expected call of SaveIdempotentResponse.
+func (mr *MockrepositoryMockRecorder) SaveIdempotentResponse(arg0, arg1, arg2, arg3, arg4 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderByUID", reflect.TypeOf((*Mockrepository)(nil).GetOrderByUID), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotentResponse", reflect.TypeOf((*Mockrepository)(nil).SaveIdempotentResponse), arg0, arg1, arg2, arg3, arg4)
 }
 
 // SaveOrder mocks base method.
-func (m *Mockrepository) SaveOrder(arg0 *models.Order) error {
+func (m *Mockrepository) SaveOrder(arg0 context.Context, arg1 *models.Order) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveOrder", arg0)
+	ret := m.ctrl.Call(m, "SaveOrder", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SaveOrder indicates an expected call of SaveOrder.
-func (mr *MockrepositoryMockRecorder) SaveOrder(arg0 any) *gomock.Call {
+func (mr *MockrepositoryMockRecorder) SaveOrder(arg0, arg1 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrder", reflect.TypeOf((*Mockrepository)(nil).SaveOrder), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrder", reflect.TypeOf((*Mockrepository)(nil).SaveOrder), arg0, arg1)
+}
+
+// SaveOrders mocks base method.
+func (m *Mockrepository) SaveOrders(arg0 context.Context, arg1 []*models.Order) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOrders", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOrders indicates an expected call of SaveOrders.
+func (mr *MockrepositoryMockRecorder) SaveOrders(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrders", reflect.TypeOf((*Mockrepository)(nil).SaveOrders), arg0, arg1)
+}
+
+// TouchOrders mocks base method.
+func (m *Mockrepository) TouchOrders(arg0 context.Context, arg1 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchOrders", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchOrders indicates an expected call of TouchOrders.
+func (mr *MockrepositoryMockRecorder) TouchOrders(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchOrders", reflect.TypeOf((*Mockrepository)(nil).TouchOrders), arg0, arg1)
 }
 
 // Mockcache is a mock of cache interface.
@@ -108,29 +239,83 @@ func (m *Mockcache) EXPECT() *MockcacheMockRecorder {
 	return m.recorder
 }
 
+// Delete mocks base method.
+func (m *Mockcache) Delete(arg0 context.Context, arg1 string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockcacheMockRecorder) Delete(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*Mockcache)(nil).Delete), arg0, arg1)
+}
+
 // GetOrder mocks base method.
-func (m *Mockcache) GetOrder(arg0 string) (models.Order, bool) {
+func (m *Mockcache) GetOrder(arg0 context.Context, arg1 string) (models.Order, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetOrder", arg0)
+	ret := m.ctrl.Call(m, "GetOrder", arg0, arg1)
 	ret0, _ := ret[0].(models.Order)
 	ret1, _ := ret[1].(bool)
 	return ret0, ret1
 }
 
 // GetOrder indicates an expected call of GetOrder.
-func (mr *MockcacheMockRecorder) GetOrder(arg0 any) *gomock.Call {
+func (mr *MockcacheMockRecorder) GetOrder(arg0, arg1 any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*Mockcache)(nil).GetOrder), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*Mockcache)(nil).GetOrder), arg0, arg1)
+}
+
+// IsNotFound mocks base method.
+func (m *Mockcache) IsNotFound(arg0 context.Context, arg1 string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsNotFound", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsNotFound indicates an expected call of IsNotFound.
+func (mr *MockcacheMockRecorder) IsNotFound(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsNotFound", reflect.TypeOf((*Mockcache)(nil).IsNotFound), arg0, arg1)
+}
+
+// SetNotFound mocks base method.
+func (m *Mockcache) SetNotFound(arg0 context.Context, arg1 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetNotFound", arg0, arg1)
+}
+
+// SetNotFound indicates an expected call of SetNotFound.
+func (mr *MockcacheMockRecorder) SetNotFound(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNotFound", reflect.TypeOf((*Mockcache)(nil).SetNotFound), arg0, arg1)
 }
 
 // SetOrder mocks base method.
-func (m *Mockcache) SetOrder(arg0 models.Order) {
+func (m *Mockcache) SetOrder(arg0 context.Context, arg1 models.Order) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SetOrder", arg0)
+	m.ctrl.Call(m, "SetOrder", arg0, arg1)
 }
 
 // SetOrder indicates an expected call of SetOrder.
-func (mr *MockcacheMockRecorder) SetOrder(arg0 any) *gomock.Call {
+func (mr *MockcacheMockRecorder) SetOrder(arg0, arg1 any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrder", reflect.TypeOf((*Mockcache)(nil).SetOrder), arg0, arg1)
+}
+
+// Versions mocks base method.
+func (m *Mockcache) Versions() map[string]int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Versions")
+	ret0, _ := ret[0].(map[string]int)
+	return ret0
+}
+
+// Versions indicates an expected call of Versions.
+func (mr *MockcacheMockRecorder) Versions() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrder", reflect.TypeOf((*Mockcache)(nil).SetOrder), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Versions", reflect.TypeOf((*Mockcache)(nil).Versions))
 }
@@ -8,7 +8,13 @@ import (
 )
 
 func InitPool(dsn string) (*pgxpool.Pool, error) {
-	dbPool, err := pgxpool.New(context.Background(), dsn)
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse dsn - %w", err)
+	}
+	cfg.ConnConfig.Tracer = queryTracer{}
+
+	dbPool, err := pgxpool.NewWithConfig(context.Background(), cfg)
 
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool - %w", err)
@@ -16,3 +22,6 @@ func InitPool(dsn string) (*pgxpool.Pool, error) {
 
 	return dbPool, nil
 }
+
+// OrderChangedChannel - канал LISTEN/NOTIFY, в который пишется каждое сохранение заказа
+const OrderChangedChannel = "order_changed"
@@ -1,9 +1,39 @@
 package errorx
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	ErrOrderValidation = errors.New("error of validation order")
-	ErrOrderNotFound   = errors.New("order not found")
-	ErrInternal        = errors.New("internal error")
+	ErrOrderValidation  = errors.New("error of validation order")
+	ErrOrderNotFound    = errors.New("order not found")
+	ErrInternal         = errors.New("internal error")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrItemConflict     = errors.New("item rid belongs to another order")
+	ErrPaymentConflict  = errors.New("payment transaction belongs to another order")
+	ErrStatusTransition = errors.New("order status transition not allowed")
+	ErrVersionNotFound  = errors.New("order version not found")
+	ErrVersionConflict  = errors.New("order version does not match expected")
+
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused with different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
 )
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %d invalid fields", ErrOrderValidation, len(e.Fields))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrOrderValidation
+}
@@ -54,28 +54,29 @@ func MakeRandomOrder() Order {
 	item := Item{
 		ChrtID:      1000000 + rand.IntN(100000),
 		TrackNumber: "WBTESTTRACK",
-		Price:       1 + rand.IntN(1000),
+		Price:       100 + rand.IntN(1000),
 		Rid:         uuid.New().String(),
 		NameItem:    "Test Name Item",
-		Sale:        rand.IntN(100),
+		Sale:        rand.IntN(50),
 		Size:        0,
-		TotalPrice:  rand.IntN(10000),
 		NmID:        0,
 		Brand:       "Test Brand",
 		Status:      202,
 	}
+	// суммы согласованы так, чтобы заказ проходил доменные правила
+	item.TotalPrice = item.Price * (100 - item.Sale) / 100
 	payment := Payment{
 		Transaction:  uuid.New().String(),
 		RequestID:    "",
 		Currency:     "USD",
 		Provider:     "wbpay",
-		Amount:       rand.IntN(100),
 		PaymentDt:    1000000 + rand.IntN(100000),
 		Bank:         "test bank",
-		DeliveryCost: rand.IntN(1000),
-		GoodsTotal:   rand.IntN(10000),
+		DeliveryCost: 1 + rand.IntN(1000),
 		CustomFee:    0,
 	}
+	payment.GoodsTotal = item.TotalPrice
+	payment.Amount = payment.GoodsTotal + payment.DeliveryCost + payment.CustomFee
 	delivery := Delivery{
 		Name:    "Test Testov",
 		Phone:   "+79000000000",
@@ -87,14 +88,14 @@ func MakeRandomOrder() Order {
 	}
 	order := Order{
 		OrderUID:          uuid.New().String(),
-		TrackNumber:       "new",
+		TrackNumber:       "WBTESTTRACK",
 		Entry:             "WBIL",
 		Locate:            "en",
 		InternalSignature: " ",
 		CustomerID:        uuid.New().String(),
 		DeliveryService:   "meest",
 		Shardkey:          "0",
-		SmID:              rand.IntN(100),
+		SmID:              1 + rand.IntN(100),
 		DateCreated:       time.Now().UTC(),
 		OffShard:          "1",
 		Delivery:          delivery,